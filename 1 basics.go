@@ -162,6 +162,7 @@ func operators() {
 	fmt.Println("Float Division:", float64(a)/float64(b))
 	fmt.Println("Multiplication:", a*b)
 	fmt.Println("Modulus/Remainder:", a%b)
+	//To try your own expressions with exactly these rules (integer division, explicit float conversion), run "28 calculator.go"
 
 }
 
@@ -414,6 +415,7 @@ func maps() {
 	//map in GO is  like dictionary in python i.e. key value pairs
 	// The zero value of a map is nil. A nil map has no keys, nor can keys be added.
 	// make maps using make function
+	// Maps and channels together: "27 map_reduce.go" groups words in a map[string][]int in each reducer goroutine
 
 	var myMap map[int]string = make(map[int]string)
 	//Alternate:
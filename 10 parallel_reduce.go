@@ -0,0 +1,140 @@
+//GENERIC PARALLEL REDUCE: sliceSum from lesson 6, for any slice and any number of goroutines
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+/*
+
+In "6 concurrency_basics.go" sliceSum adds up a slice of int, and main splits primes into exactly TWO halves by hand.
+Here we generalize both limits:
+	-the slice can be of any element type T and the result of any type R (GENERICS, Go 1.18+)
+	-the slice is split into N parts, one goroutine each (by default N = GOMAXPROCS, i.e. the number of CPUs Go will use)
+
+A reduce ("fold") needs two functions:
+	-fold(acc R, v T) R         : adds ONE element to a running result. Each goroutine runs this over its own part.
+	-combine(left R, right R) R : joins the results of TWO parts. main runs this on what comes back over the channel.
+
+ORDERING: goroutines finish in any order (see the Partial Sum1/Sum2 comments in lesson 6). Every part sends its index along with its result, and the results are combined in index order.
+So combine does not have to be commutative: concatenating strings gives the same answer as the serial loop. It DOES have to be associative, and init has to be an identity for combine (0 for +, "" for concatenation).
+
+*/
+
+// partial is what one goroutine sends back: which part it worked on, and the result for that part
+type partial[R any] struct {
+	index  int
+	result R
+}
+
+// ParallelReduce folds s using up to workers goroutines (workers <= 0 means GOMAXPROCS)
+func ParallelReduce[T any, R any](s []T, workers int, init R, fold func(R, T) R, combine func(R, R) R) R {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(s) {
+		workers = len(s) //no point starting goroutines with nothing to do
+	}
+	if workers <= 1 {
+		return serialReduce(s, init, fold)
+	}
+
+	//buffered so that no goroutine ever blocks on its send, even if main stopped listening
+	results := make(chan partial[R], workers)
+
+	//split into 'workers' parts whose sizes differ by at most one
+	size, extra := len(s)/workers, len(s)%workers
+	start := 0
+	for i := 0; i < workers; i++ {
+		end := start + size
+		if i < extra {
+			end++
+		}
+		go func(index int, part []T) {
+			results <- partial[R]{index, serialReduce(part, init, fold)}
+		}(i, s[start:end])
+		start = end
+	}
+
+	//collect all the parts, then combine them in order
+	ordered := make([]R, workers)
+	for i := 0; i < workers; i++ {
+		p := <-results
+		ordered[p.index] = p.result
+	}
+	total := ordered[0]
+	for _, r := range ordered[1:] {
+		total = combine(total, r)
+	}
+	return total
+}
+
+func serialReduce[T any, R any](s []T, init R, fold func(R, T) R) R {
+	acc := init
+	for _, v := range s {
+		acc = fold(acc, v)
+	}
+	return acc
+}
+
+// ParallelSum is the sliceSum of lesson 6, for every kind of number. The ~ means "any type whose underlying type is".
+func ParallelSum[N ~int | ~int64 | ~float64](s []N, workers int) N {
+	add := func(a, b N) N { return a + b }
+	return ParallelReduce(s, workers, 0, add, add)
+}
+
+// sink keeps the compiler from throwing away benchmark results it can see are never used
+var sink int
+
+func main() {
+
+	//-------lesson 6, now with any number of goroutines
+	primes := []int{2, 3, 5, 7, 11, 13}
+	fmt.Println("Sum with 2 goroutines:", ParallelSum(primes, 2))
+	fmt.Println("Sum with 4 goroutines:", ParallelSum(primes, 4))
+	fmt.Println("Sum with GOMAXPROCS =", runtime.GOMAXPROCS(0), "goroutines:", ParallelSum(primes, 0))
+
+	//-------different T and R: count the letters in a slice of words
+	words := strings.Fields("go is a general purpose language designed with systems programming in mind")
+	letters := ParallelReduce(words, 3, 0,
+		func(acc int, w string) int { return acc + len(w) },
+		func(a, b int) int { return a + b })
+	fmt.Println("Letters:", letters)
+
+	//-------ORDERING: string concatenation is not commutative, yet the result is the same as a plain loop
+	joined := ParallelReduce(words, 5, "",
+		func(acc string, w string) string { return acc + w[:1] },
+		func(a, b string) string { return a + b })
+	fmt.Println("First letters in order:", joined)
+
+	//-------BENCHMARKS
+	/*
+		testing.Benchmark runs a benchmark function from a normal program (no _test.go file needed) and picks b.N for us.
+		Goroutines and channels are not free: for small slices the serial loop wins. The parallel version only pays off when each goroutine has enough work, and when there is more than one CPU to run on.
+	*/
+	for _, n := range []int{1_000, 100_000, 10_000_000} {
+		nums := make([]int, n)
+		for i := range nums {
+			nums[i] = i
+		}
+		serial := testing.Benchmark(func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sum := 0 //the same loop as sliceSum
+				for _, v := range nums {
+					sum += v
+				}
+				sink = sum
+			}
+		})
+		parallel := testing.Benchmark(func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sink = ParallelSum(nums, 0)
+			}
+		})
+		fmt.Printf("n=%-10d serial %12d ns/op   parallel %12d ns/op\n", n, serial.NsPerOp(), parallel.NsPerOp())
+	}
+}
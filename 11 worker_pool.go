@@ -0,0 +1,276 @@
+//WORKER POOL: a reusable version of the "go sliceSum(...)" goroutines from lesson 6
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+/*
+
+In "6 concurrency_basics.go" we start one goroutine per job by hand (go sliceSum(...)) and receive exactly two results (<-sumChan, <-sumChan).
+That does not scale: with 10,000 slices we do not want 10,000 goroutines, and we do not want to count receives by hand.
+
+A WORKER POOL fixes a number of goroutines (workers) that take jobs from a queue:
+	-fixed number of workers        : at most N jobs run at the same time
+	-bounded job queue              : a buffered channel (lesson 6). Submit blocks when it is full, which slows down a producer that is too fast ("back pressure")
+	-typed results                  : every Result carries its Job, the value and an error, so nobody has to guess which goroutine a value came from
+	-context cancellation           : cancelling the context stops workers from picking up new jobs
+	-graceful shutdown              : Close stops new submissions, lets the workers DRAIN what is already queued, and closes Results when the last one is done
+	-per job panic isolation        : a job that panics becomes a Result with an error. The worker (and the program) keep going.
+
+*/
+
+var (
+	ErrPoolClosed = errors.New("worker pool is closed")
+	ErrJobPanic   = errors.New("job panicked")
+)
+
+// Result is what a worker produces for one job
+type Result[J any, R any] struct {
+	Job   J
+	Value R
+	Err   error
+}
+
+// Pool runs fn on every submitted job using a fixed number of goroutines
+type Pool[J any, R any] struct {
+	ctx     context.Context
+	fn      func(context.Context, J) (R, error)
+	jobs    chan J
+	results chan Result[J, R]
+	wg      sync.WaitGroup //counts running workers
+
+	//Sending on a closed channel panics (lesson 6), so Submit and Close must not race. Submit holds mu for READING while it sends,
+	//Close takes it for WRITING only to close jobs. quit is closed first, so that a Submit blocked on a full queue lets go of mu.
+	mu        sync.RWMutex
+	closed    bool
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPool starts 'workers' goroutines. queueSize is the capacity of the job queue.
+func NewPool[J any, R any](ctx context.Context, workers, queueSize int, fn func(context.Context, J) (R, error)) *Pool[J, R] {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &Pool[J, R]{
+		ctx:     ctx,
+		fn:      fn,
+		jobs:    make(chan J, queueSize),
+		results: make(chan Result[J, R], workers),
+		quit:    make(chan struct{}),
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	//close Results once every worker has returned, so that callers can range over it
+	go func() {
+		p.wg.Wait()
+		close(p.results)
+	}()
+	return p
+}
+
+func (p *Pool[J, R]) worker() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case job, ok := <-p.jobs:
+			if !ok { //queue closed and empty: the drain is complete
+				return
+			}
+			r := p.run(job)
+			select {
+			case p.results <- r:
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// run calls fn for one job. The deferred recover turns a panic into an error for THIS job only.
+func (p *Pool[J, R]) run(job J) (r Result[J, R]) {
+	r.Job = job
+	defer func() {
+		if v := recover(); v != nil {
+			r.Err = fmt.Errorf("%w: %v", ErrJobPanic, v)
+		}
+	}()
+	r.Value, r.Err = p.fn(p.ctx, job)
+	return r
+}
+
+// Submit queues a job. It blocks while the queue is full, and gives up when ctx (or the pool's context) is cancelled.
+func (p *Pool[J, R]) Submit(ctx context.Context, job J) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	select {
+	case p.jobs <- job:
+		return nil
+	case <-p.quit: //Close was called while we were waiting for room
+		return ErrPoolClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+// Close stops accepting jobs. Jobs already queued are still run; Results is closed after the last one.
+// It does not wait for anybody to read Results, even when Submits are blocked on a full queue.
+func (p *Pool[J, R]) Close() {
+	p.closeOnce.Do(func() {
+		close(p.quit) //wakes the blocked Submits: they return ErrPoolClosed and release mu
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.closed = true
+		close(p.jobs) //only the sender closes a channel, and Submit is the only sender. No Submit is inside its send now.
+	})
+}
+
+// Results delivers one Result per job that was run
+func (p *Pool[J, R]) Results() <-chan Result[J, R] {
+	return p.results
+}
+
+// Wait blocks until all workers have returned: after Close, that means every queued job is done
+func (p *Pool[J, R]) Wait() {
+	p.wg.Wait()
+}
+
+// job and sumSlice are the lesson 6 sliceSum, as a pool job
+type job struct {
+	ID    int
+	Slice []int
+}
+
+func sumSlice(ctx context.Context, j job) (int, error) {
+	if j.Slice == nil {
+		panic(fmt.Sprintf("job %d has no slice", j.ID)) //a bug in one job...
+	}
+	sum := 0
+	for _, val := range j.Slice {
+		sum += val
+	}
+	return sum, nil
+}
+
+func main() {
+
+	//-------SUMMING MANY SLICES THROUGH THE POOL
+	ctx := context.Background()
+	pool := NewPool(ctx, 4, 8, sumSlice) //4 workers, at most 8 jobs waiting
+
+	const numJobs = 100
+	//producer: in its own goroutine, because Submit blocks while the queue is full and the results must be read at the same time
+	go func() {
+		defer pool.Close() //graceful shutdown once everything is submitted
+		for i := 0; i < numJobs; i++ {
+			j := job{ID: i, Slice: []int{i, i, i}} //sum is 3*i
+			if i == 42 {
+				j.Slice = nil
+			}
+			if err := pool.Submit(ctx, j); err != nil {
+				log.Println("submit:", err)
+				return
+			}
+		}
+	}()
+
+	total, done := 0, 0
+	for r := range pool.Results() { //ends when the pool has drained and closed Results
+		if r.Err != nil {
+			fmt.Printf("job %d failed: %v\n", r.Job.ID, r.Err) //...only fails that job
+			continue
+		}
+		total += r.Value
+		done++
+	}
+	fmt.Printf("%d jobs succeeded, total = %d (expected %d)\n", done, total, 3*(numJobs*(numJobs-1)/2-42))
+
+	if err := pool.Submit(ctx, job{ID: 999, Slice: []int{1}}); errors.Is(err, ErrPoolClosed) {
+		fmt.Println("Submit after Close:", err)
+	}
+
+	//-------CANCELLATION
+	//slow jobs and a context that times out: workers stop picking up new jobs and Submit gives up
+	ctx2, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	slow := NewPool(ctx2, 2, 2, func(ctx context.Context, n int) (int, error) {
+		select {
+		case <-time.After(100 * time.Millisecond): //pretend to work
+			return n, nil
+		case <-ctx.Done(): //a well behaved job checks the context too
+			return 0, ctx.Err()
+		}
+	})
+	go func() {
+		defer slow.Close()
+		for i := 0; ; i++ {
+			if err := slow.Submit(ctx2, i); err != nil {
+				fmt.Println("producer stopped after", i, "jobs:", err)
+				return
+			}
+		}
+	}()
+	finished := 0
+	for r := range slow.Results() {
+		if r.Err == nil {
+			finished++
+		}
+	}
+	fmt.Println("jobs finished before the timeout:", finished)
+
+	checkCloseWhileSubmitBlocked()
+}
+
+// checkCloseWhileSubmitBlocked fills the pool while nobody reads Results, so the last Submit blocks, then calls Close
+func checkCloseWhileSubmitBlocked() {
+	ctx := context.Background()
+	stuck := NewPool(ctx, 1, 1, func(ctx context.Context, n int) (int, error) { return n, nil })
+
+	//1 result in the Results buffer, 1 job waiting for the worker to send its result, 1 job in the queue: the 4th Submit has no room
+	submitted := make(chan error)
+	go func() {
+		for i := 0; ; i++ {
+			if err := stuck.Submit(ctx, i); err != nil {
+				submitted <- err
+				return
+			}
+		}
+	}()
+	time.Sleep(20 * time.Millisecond) //let the producer get stuck
+
+	closed := make(chan struct{})
+	go func() {
+		stuck.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		panic("Close is blocked behind a Submit waiting for room")
+	}
+	if err := <-submitted; !errors.Is(err, ErrPoolClosed) {
+		panic(fmt.Sprintf("blocked Submit after Close: %v", err))
+	}
+
+	drained := 0
+	for range stuck.Results() { //the jobs that were queued still run
+		drained++
+	}
+	fmt.Printf("ok: Close returned while a Submit was blocked; the Submit got %q and %d queued jobs still ran\n", ErrPoolClosed, drained)
+}
@@ -0,0 +1,349 @@
+//GOROUTINE LEAK DETECTOR: find goroutines a lesson forgot to stop
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+
+A goroutine that can never finish is LEAKED. Some of the lessons used to leak, to keep them short:
+	-"6 concurrency_basics.go" (before it used a context): the portal that lost the select blocked forever on its send
+	-"5 go_threads.go" main (before it used a WaitGroup): go say("world") may still be running when main returns
+	-"5 go_threads.go" main2 (before it used a WaitGroup): go fmt.Println(i) may still be running when main2 returns
+
+A leak in a program that exits is harmless. A leak in a server that runs for months is a memory leak that grows with every request.
+
+HOW THE DETECTOR WORKS
+	-runtime.Stack(buf, true) writes the stack trace of EVERY goroutine, each starting with a line like "goroutine 7 [chan send]:"
+	-we take a snapshot of goroutine IDs BEFORE running a function and another one AFTER it returns
+	-IDs that only appear in the second snapshot were started by the function and are still alive
+	-goroutines may need a moment to finish after the function returns, so we retry for a short grace period before calling it a leak
+	-some goroutines belong to the runtime or the testing package and are always ignored
+
+VerifyNone is written for tests: it takes anything with Helper and Errorf, which *testing.T has. In this file the same methods are implemented by a tiny lesson harness, so the checks can be run with go run.
+
+Every lesson is its own package main, so this file cannot call their functions. The harness runs COPIES instead, with shorter sleeps:
+	-the leaky versions are the lesson code as it was before the fix. Each one is EXPECTED to fail
+	-the fixed versions are the lesson code as it is now. Each one must pass
+In the old lesson 5, whether "world" or the counting goroutines were still running when main returned depended on the scheduler.
+The copies make the unlucky case happen every time: those goroutines wait on mainReturned, a channel that is never closed,
+just like a real program never gets back to a goroutine that was still running when main returned.
+
+	func TestSelectDemo(t *testing.T) {
+		VerifyNone(t, selectDemo)
+	}
+
+*/
+
+// Reporter is the part of *testing.T that VerifyNone needs
+type Reporter interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Goroutine is one entry of a runtime.Stack dump
+type Goroutine struct {
+	ID    int
+	State string //e.g. "chan send", "sleep", "select"
+	Stack string //the full text of the entry, for the report
+}
+
+// ignoredFunctions are goroutines that exist no matter what the lesson does
+var ignoredFunctions = []string{
+	"testing.Main(",
+	"testing.(*T).Run(",
+	"testing.tRunner(",
+	"testing.(*M).",
+	"os/signal.signal_recv(",
+	"os/signal.loop(",
+	"runtime.ensureSigM(",
+	"runtime.goexit",
+}
+
+// gracePeriod is how long VerifyNone waits for goroutines that are about to finish
+var gracePeriod = 500 * time.Millisecond
+
+// Goroutines returns every goroutine except the one calling it
+func Goroutines() []Goroutine {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf)) //stack dump did not fit: try again with a bigger buffer
+	}
+
+	entries := strings.Split(string(buf), "\n\n")
+	var list []Goroutine
+	for i, entry := range entries {
+		if i == 0 {
+			continue //the first entry is always the calling goroutine
+		}
+		g, ok := parseGoroutine(entry)
+		if !ok || ignored(g) {
+			continue
+		}
+		list = append(list, g)
+	}
+	return list
+}
+
+// parseGoroutine reads the header line "goroutine 7 [chan send, 2 minutes]:"
+func parseGoroutine(entry string) (Goroutine, bool) {
+	header, _, _ := strings.Cut(entry, "\n")
+	rest, ok := strings.CutPrefix(header, "goroutine ")
+	if !ok {
+		return Goroutine{}, false
+	}
+	idText, state, _ := strings.Cut(rest, " ")
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return Goroutine{}, false
+	}
+	state = strings.TrimSuffix(strings.TrimPrefix(state, "["), "]:")
+	state, _, _ = strings.Cut(state, ",") //drop ", 2 minutes"
+	return Goroutine{ID: id, State: state, Stack: strings.TrimSpace(entry)}, true
+}
+
+// ignored looks at the top of the stack (the function the goroutine is in) and at the function that created it
+func ignored(g Goroutine) bool {
+	lines := strings.Split(g.Stack, "\n")
+	var interesting []string
+	if len(lines) > 1 {
+		interesting = append(interesting, lines[1])
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "created by ") {
+			interesting = append(interesting, strings.TrimPrefix(line, "created by "))
+		}
+	}
+	for _, line := range interesting {
+		for _, fn := range ignoredFunctions {
+			if strings.HasPrefix(line, fn) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Leaks runs fn and returns the goroutines it started that are still alive after the grace period
+func Leaks(fn func()) []Goroutine {
+	before := make(map[int]bool)
+	for _, g := range Goroutines() {
+		before[g.ID] = true
+	}
+
+	fn()
+
+	deadline := time.Now().Add(gracePeriod)
+	for {
+		var leaked []Goroutine
+		for _, g := range Goroutines() {
+			if !before[g.ID] {
+				leaked = append(leaked, g)
+			}
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			sort.Slice(leaked, func(i, j int) bool { return leaked[i].ID < leaked[j].ID })
+			return leaked
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// VerifyNone fails the test (or lesson) with the stack trace of every goroutine fn leaked
+func VerifyNone(r Reporter, fn func()) {
+	r.Helper()
+	leaked := Leaks(fn)
+	if len(leaked) == 0 {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d goroutine(s) leaked:\n", len(leaked))
+	for _, g := range leaked {
+		fmt.Fprintf(&b, "\n%s\n", g.Stack)
+	}
+	r.Errorf("%s", b.String())
+}
+
+//-------THE LESSON HARNESS
+
+// lessonRun plays the role of *testing.T for one lesson section
+type lessonRun struct {
+	name   string
+	failed bool
+}
+
+func (l *lessonRun) Helper() {}
+
+func (l *lessonRun) Errorf(format string, args ...any) {
+	l.failed = true
+	fmt.Printf("--- FAIL: %s\n    %s\n", l.name, strings.ReplaceAll(fmt.Sprintf(format, args...), "\n", "\n    "))
+}
+
+type section struct {
+	name  string
+	fn    func()
+	leaky bool //the old lesson code: VerifyNone is expected to fail
+}
+
+// runLessons runs every section under VerifyNone and returns how many did not do what was expected: leaky sections must fail, the others must pass
+func runLessons(sections []section) int {
+	unexpected := 0
+	for _, s := range sections {
+		run := &lessonRun{name: s.name}
+		VerifyNone(run, s.fn)
+		switch {
+		case run.failed && s.leaky:
+			fmt.Printf("    (expected: %s is the lesson code before the fix)\n", s.name)
+		case run.failed:
+			unexpected++
+		case s.leaky:
+			fmt.Printf("--- PASS: %s, but it was expected to leak\n", s.name)
+			unexpected++
+		default:
+			fmt.Printf("--- PASS: %s\n", s.name)
+		}
+	}
+	return unexpected
+}
+
+//-------LESSON SECTIONS (copies: the leaky code as it was, and the fixed code as the lessons have it now)
+
+func say(s string) {
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond) //shorter than lesson 5 so the harness runs quickly
+		fmt.Println(s)
+	}
+}
+
+// mainReturned stands for "main has returned" in the copies of the old lesson 5: it is never closed.
+// A goroutine waiting on it is one that was still running when main returned, and never got to finish.
+var mainReturned = make(chan struct{})
+
+// lesson 5 main before the WaitGroup: nothing waits for "world".
+// Both say() take about as long, so who finishes first was up to the scheduler. Here "world" always loses: its last word waits for mainReturned.
+func sayUnwaited() {
+	go func() {
+		say("world")
+		<-mainReturned
+		fmt.Println("world") //the last "world", never printed
+	}()
+	say("hello")
+}
+
+// lesson 5 main now: a WaitGroup waits for "world"
+func sayWaited() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		say("world")
+	}()
+	say("hello")
+	wg.Wait()
+}
+
+// lesson 5 main2 before the WaitGroup (and without its time.Sleep): main2 returns before the goroutines have printed
+func countUnwaited() {
+	for i := 0; i < 11; i++ {
+		go func() {
+			<-mainReturned //the unlucky case, every time: main2 has returned before this goroutine got to run
+			fmt.Println(i)
+		}()
+	}
+}
+
+// lesson 5 main2 now
+func countWaited() {
+	var wg sync.WaitGroup
+	for i := 0; i < 11; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fmt.Println(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// lesson 6 select before contexts were added: the loser blocks on its send forever
+func selectLeaky() {
+	r1, r2 := make(chan string), make(chan string)
+	go func() { time.Sleep(10 * time.Millisecond); r1 <- "Welcome to channel 1" }()
+	go func() { time.Sleep(30 * time.Millisecond); r2 <- "Welcome to channel 2" }()
+	select {
+	case op := <-r1:
+		fmt.Println(op)
+	case op := <-r2:
+		fmt.Println(op)
+	}
+}
+
+// portal is portal1 and portal2 of lesson 6: both the wait and the send give up when ctx is cancelled
+func portal(ctx context.Context, channel chan string, delay time.Duration, msg string) {
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case channel <- msg:
+	case <-ctx.Done():
+	}
+}
+
+// lesson 6 select now: cancel() stops the loser, and the WaitGroup waits for both portals
+func selectFixed() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	var portals sync.WaitGroup
+	portals.Add(2)
+	r1, r2 := make(chan string), make(chan string)
+	go func() {
+		defer portals.Done()
+		portal(ctx, r1, 10*time.Millisecond, "Welcome to channel 1")
+	}()
+	go func() {
+		defer portals.Done()
+		portal(ctx, r2, 30*time.Millisecond, "Welcome to channel 2")
+	}()
+	select {
+	case op := <-r1:
+		fmt.Println(op)
+	case op := <-r2:
+		fmt.Println(op)
+	case <-ctx.Done():
+		fmt.Println("No portal answered in time:", ctx.Err())
+	}
+	cancel()
+	portals.Wait()
+}
+
+func main() {
+	unexpected := runLessons([]section{
+		{"lesson 5 say (not waited for)", sayUnwaited, true},
+		{"lesson 5 say (WaitGroup)", sayWaited, false},
+		{"lesson 5 main2 counting (not waited for)", countUnwaited, true},
+		{"lesson 5 main2 counting (WaitGroup)", countWaited, false},
+		{"lesson 6 select (leaky)", selectLeaky, true},
+		{"lesson 6 select (context)", selectFixed, false},
+	})
+	if unexpected > 0 {
+		fmt.Println(unexpected, "section(s) did not do what was expected")
+		os.Exit(1)
+	}
+	fmt.Println("ok: the three leaky versions leaked, the fixed versions did not")
+}
@@ -0,0 +1,287 @@
+//GENERATORS: lazy sequences, first with channels (like fibonacci in lesson 6), then with iter.Seq (Go 1.23+)
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"testing"
+	"time"
+)
+
+/*
+
+fibonacci(c, quit chan int) in "6 concurrency_basics.go" is a GENERATOR: it produces values only when somebody asks for the next one, and it stops when told to on the quit channel.
+This lesson turns the idea into a small generic library with two kinds of producers:
+
+	1) CHANNEL generators: a goroutine sends values on a channel. A context.Context replaces the quit channel, so stopping works the same way everywhere.
+	2) ITERATOR generators: iter.Seq[T] is just a function type
+
+		type Seq[V any] func(yield func(V) bool)
+
+	   The producer calls yield once per value. When yield returns false the consumer wants no more values and the producer must return.
+	   A for loop can range over it directly:  for v := range Fibonacci() { ... }
+	   No goroutine, no channel, no cleanup: when the loop breaks, the function just returns.
+
+COMBINATORS take a sequence and return a new one, without computing anything until the result is ranged over:
+	Take(n, s)     the first n values
+	Map(s, f)      f(v) for every v
+	Filter(s, f)   only the v for which f(v) is true
+	Zip(a, b)      pairs (a1,b1), (a2,b2), ... until the shorter one ends
+	Chunk(s, n)    slices of n values (the last one may be shorter)
+
+*/
+
+//-------1) CHANNEL GENERATORS
+
+// FibonacciChan is lesson 6's fibonacci, with ctx.Done() instead of the quit channel. The channel is closed when the goroutine exits.
+func FibonacciChan(ctx context.Context) <-chan int {
+	c := make(chan int)
+	go func() {
+		defer close(c)
+		x, y := 0, 1
+		for {
+			select {
+			case c <- x: //sending on a channel
+				x, y = y, x+y
+			case <-ctx.Done(): //replaces case <-quit
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// TakeChan forwards the first n values and then stops. Cancel ctx to stop the producer as well.
+func TakeChan[T any](ctx context.Context, n int, in <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for i := 0; i < n; i++ {
+			var v T
+			select {
+			case next, ok := <-in:
+				if !ok {
+					return
+				}
+				v = next
+			case <-ctx.Done(): //the producer may be stuck too, and never send or close in
+				return
+			}
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// ToChan runs an iterator in a goroutine and sends its values on a channel, so iterators can be used where a channel is expected
+func ToChan[T any](ctx context.Context, s iter.Seq[T]) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for v := range s {
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return //returning from the range body makes yield return false: the iterator stops too
+			}
+		}
+	}()
+	return out
+}
+
+// FromChan turns a channel into an iterator. Breaking out of the loop does NOT stop the sender: cancel its context for that.
+func FromChan[T any](c <-chan T) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for v := range c {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+//-------2) ITERATOR GENERATORS
+
+// Fibonacci is an endless sequence. It is safe because it stops as soon as yield returns false.
+func Fibonacci() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		x, y := 0, 1
+		for {
+			if !yield(x) {
+				return
+			}
+			x, y = y, x+y
+		}
+	}
+}
+
+// Count yields start, start+1, start+2, ... forever
+func Count(start int) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for i := start; yield(i); i++ {
+		}
+	}
+}
+
+func Take[T any](n int, s iter.Seq[T]) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		if n <= 0 {
+			return
+		}
+		i := 0
+		for v := range s {
+			if !yield(v) {
+				return
+			}
+			i++
+			if i == n {
+				return //stops s as well: this is what makes Take(10, Fibonacci()) finish
+			}
+		}
+	}
+}
+
+func Map[T, U any](s iter.Seq[T], f func(T) U) iter.Seq[U] {
+	return func(yield func(U) bool) {
+		for v := range s {
+			if !yield(f(v)) {
+				return
+			}
+		}
+	}
+}
+
+func Filter[T any](s iter.Seq[T], keep func(T) bool) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for v := range s {
+			if keep(v) && !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// Pair holds one value from each sequence given to Zip
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+// Zip walks a and b side by side. iter.Pull turns b into a "next()" function so the two sequences can advance together.
+func Zip[A, B any](a iter.Seq[A], b iter.Seq[B]) iter.Seq[Pair[A, B]] {
+	return func(yield func(Pair[A, B]) bool) {
+		next, stop := iter.Pull(b)
+		defer stop() //always release b, whichever way we leave
+		for va := range a {
+			vb, ok := next()
+			if !ok {
+				return
+			}
+			if !yield(Pair[A, B]{va, vb}) {
+				return
+			}
+		}
+	}
+}
+
+// Chunk groups the values in slices of size n. Every chunk is a new slice, so it is safe to keep it.
+func Chunk[T any](s iter.Seq[T], n int) iter.Seq[[]T] {
+	return func(yield func([]T) bool) {
+		if n <= 0 {
+			return
+		}
+		chunk := make([]T, 0, n)
+		for v := range s {
+			chunk = append(chunk, v)
+			if len(chunk) == n {
+				if !yield(chunk) {
+					return
+				}
+				chunk = make([]T, 0, n)
+			}
+		}
+		if len(chunk) > 0 {
+			yield(chunk)
+		}
+	}
+}
+
+// Collect is slices.Collect, written out to show there is no magic
+func Collect[T any](s iter.Seq[T]) []T {
+	var out []T
+	for v := range s {
+		out = append(out, v)
+	}
+	return out
+}
+
+func main() {
+
+	//-------printFibonacci from lesson 6, in one line
+	fmt.Println("fibonacci TIME")
+	for v := range Take(10, Fibonacci()) {
+		fmt.Println(v)
+	}
+
+	//-------the channel version: cancel() plays the role of flagChan <- 0
+	ctx, cancel := context.WithCancel(context.Background())
+	fmt.Println("channel:", Collect(FromChan(TakeChan(ctx, 10, FibonacciChan(ctx)))))
+	cancel() //stops the FibonacciChan goroutine, which is still waiting to send the 11th number
+
+	//a producer that never sends: cancelling ctx still stops TakeChan, which would otherwise wait on it forever
+	stuck, cancelStuck := context.WithCancel(context.Background())
+	taken := TakeChan(stuck, 10, make(chan int))
+	cancelStuck()
+	select {
+	case _, ok := <-taken:
+		if ok {
+			panic("TakeChan: a value from a channel that never sends")
+		}
+		fmt.Println("channel: TakeChan stopped on cancel while waiting for the producer")
+	case <-time.After(time.Second):
+		panic("TakeChan: still waiting for the producer after cancel")
+	}
+
+	//-------COMBINATORS
+	evens := Filter(Fibonacci(), func(n int) bool { return n%2 == 0 })
+	fmt.Println("even fibonacci numbers:", Collect(Take(6, evens)))
+
+	squares := Map(Count(1), func(n int) string { return fmt.Sprintf("%d^2=%d", n, n*n) })
+	fmt.Println("squares:", Collect(Take(4, squares)))
+
+	for p := range Take(5, Zip(Count(0), Fibonacci())) {
+		fmt.Printf("fib(%d) = %d\n", p.First, p.Second)
+	}
+
+	for c := range Chunk(Take(10, Fibonacci()), 4) {
+		fmt.Println("chunk:", c)
+	}
+
+	//-------BENCHMARKS: the cost of 1000 fibonacci numbers each way
+	/*
+		Every value sent on an unbuffered channel is a hand-over between two goroutines, so the scheduler is involved each time.
+		An iterator is a plain function call. Expect the iterator to be MUCH faster.
+	*/
+	const n = 1000
+	withChan := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ctx, cancel := context.WithCancel(context.Background())
+			for range TakeChan(ctx, n, FibonacciChan(ctx)) {
+			}
+			cancel()
+		}
+	})
+	withIter := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for range Take(n, Fibonacci()) {
+			}
+		}
+	})
+	fmt.Printf("%d values: channel %d ns/op, iterator %d ns/op\n", n, withChan.NsPerOp(), withIter.NsPerOp())
+}
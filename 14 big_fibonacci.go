@@ -0,0 +1,171 @@
+//BIG FIBONACCI: fibonacci numbers that never overflow, using math/big
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"iter"
+	"log"
+	"math"
+	"math/big"
+	"time"
+)
+
+/*
+
+fibonacci in "6 concurrency_basics.go" uses int. On a 64 bit machine the largest int is math.MaxInt64 = 9223372036854775807, and fib(92) is the last fibonacci number below it.
+x+y for fib(93) OVERFLOWS: Go does not stop or report an error, the number silently wraps around and becomes negative.
+
+math/big provides big.Int, an integer with as many digits as memory allows. The price:
+	-values are used through pointers (*big.Int) and the arithmetic is done with methods: z.Add(x, y) means z = x + y
+	-each operation costs time proportional to the number of digits
+
+Two ways to get fibonacci numbers:
+	-BigFibonacci() streams fib(0), fib(1), fib(2), ... one addition per term. Good for printing them all.
+	-FibN(n) jumps straight to fib(n) with the FAST DOUBLING formulas, in about log2(n) steps:
+		fib(2k)   = fib(k) * (2*fib(k+1) - fib(k))
+		fib(2k+1) = fib(k)^2 + fib(k+1)^2
+
+Run with flags, e.g.:
+	go run "14 big_fibonacci.go" -terms 1000000 -format digits
+	go run "14 big_fibonacci.go" -n 100000 -format truncate -width 20
+
+*/
+
+// BigFibonacci yields every fibonacci number in turn.
+// To stream millions of terms without allocating millions of big.Ints, the SAME two big.Ints are reused:
+// the value passed to yield is only valid until the next iteration. Use new(big.Int).Set(v) to keep one.
+func BigFibonacci() iter.Seq[*big.Int] {
+	return func(yield func(*big.Int) bool) {
+		x, y := big.NewInt(0), big.NewInt(1)
+		for {
+			if !yield(x) {
+				return
+			}
+			x.Add(x, y) //x, y = y, x+y without a temporary: x becomes x+y...
+			x, y = y, x //...and then the two are swapped
+		}
+	}
+}
+
+// FibN returns fib(n) using fast doubling. It walks the bits of n from the most significant one down.
+func FibN(n uint64) *big.Int {
+	a, b := big.NewInt(0), big.NewInt(1) //fib(k), fib(k+1) with k = 0
+	t1, t2 := new(big.Int), new(big.Int)
+	for bit := 63; bit >= 0; bit-- {
+		//doubling step: k -> 2k
+		t1.Lsh(b, 1)  //2*fib(k+1)
+		t1.Sub(t1, a) //2*fib(k+1) - fib(k)
+		t1.Mul(t1, a) //fib(2k)
+		t2.Mul(a, a)  //fib(k)^2
+		b.Mul(b, b)   //fib(k+1)^2
+		t2.Add(t2, b) //fib(2k+1)
+		a.Set(t1)
+		b.Set(t2)
+
+		//if this bit of n is 1: k -> k+1
+		if n&(1<<uint(bit)) != 0 {
+			t1.Add(a, b)
+			a.Set(b)
+			b.Set(t1)
+		}
+	}
+	return a
+}
+
+// Format says how FormatBig shows a number
+type Format string
+
+const (
+	FormatFull     Format = "full"     //every digit
+	FormatDigits   Format = "digits"   //only how many digits there are
+	FormatTruncate Format = "truncate" //first and last digits: 12345...67890 (20899 digits)
+)
+
+// FormatBig renders v according to f. width is the number of leading AND trailing digits kept by FormatTruncate.
+func FormatBig(v *big.Int, f Format, width int) (string, error) {
+	switch f {
+	case FormatFull:
+		return v.String(), nil
+	case FormatDigits:
+		return fmt.Sprintf("(%d digits)", len(v.String())), nil
+	case FormatTruncate:
+		s := v.String()
+		if width <= 0 || len(s) <= 2*width {
+			return s, nil
+		}
+		return fmt.Sprintf("%s...%s (%d digits)", s[:width], s[len(s)-width:], len(s)), nil
+	}
+	return "", fmt.Errorf("unknown format %q (want full, digits or truncate)", f)
+}
+
+func main() {
+	terms := flag.Int("terms", 100000, "number of terms to stream")
+	n := flag.Uint64("n", 1000, "index for FibN random access")
+	format := flag.String("format", string(FormatTruncate), "output format: full, digits or truncate")
+	width := flag.Int("width", 10, "digits kept at each end by -format truncate")
+	flag.Parse()
+	if *terms < 1 {
+		log.Fatal("-terms must be at least 1")
+	}
+
+	show := func(label string, v *big.Int) {
+		s, err := FormatBig(v, Format(*format), *width)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(label, s)
+	}
+
+	//-------THE OVERFLOW
+	fmt.Println("-------int overflow")
+	x, y := 0, 1
+	for i := 0; i <= 93; i++ {
+		if i >= 91 {
+			fmt.Printf("int fib(%d) = %d\n", i, x)
+		}
+		x, y = y, x+y
+	}
+	fmt.Println("math.MaxInt64 =", math.MaxInt64, " <- fib(93) does not fit, so it wrapped around")
+	i := 0
+	for v := range BigFibonacci() {
+		if i == 93 {
+			fmt.Println("big fib(93) =", v)
+			break
+		}
+		i++
+	}
+
+	//-------STREAMING
+	fmt.Printf("-------streaming %d terms\n", *terms)
+	start := time.Now()
+	i = 0
+	for v := range BigFibonacci() {
+		if i == *terms-1 {
+			show(fmt.Sprintf("fib(%d) =", i), v)
+			break
+		}
+		i++
+	}
+	fmt.Println("took", time.Since(start).Round(time.Millisecond))
+
+	//-------RANDOM ACCESS
+	fmt.Println("-------fast doubling")
+	start = time.Now()
+	show(fmt.Sprintf("FibN(%d) =", *n), FibN(*n))
+	fmt.Println("took", time.Since(start).Round(time.Microsecond))
+
+	//both ways must agree
+	check := 0
+	for v := range BigFibonacci() {
+		if FibN(uint64(check)).Cmp(v) != 0 {
+			log.Fatalf("FibN(%d) disagrees with the stream", check)
+		}
+		check++
+		if check > 300 {
+			break
+		}
+	}
+	fmt.Println("FibN agrees with the stream for n = 0..300")
+}
@@ -0,0 +1,240 @@
+//PIPELINES: chaining goroutines with channels, stage after stage
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+/*
+
+Lesson 6 only ever uses a channel for ONE hop: sliceSum -> main, fibonacci -> printFibonacci.
+A PIPELINE chains many hops. Each STAGE is a group of goroutines that
+	-receives values from an inbound channel
+	-does some work on each value
+	-sends the results on an outbound channel
+
+	generator ---> square ---> sum
+	        chan int     chan int
+
+Getting the details right is the hard part, so this small library does it once:
+	-closing channels : every stage closes its OUTBOUND channel when all its goroutines are done (only the sender closes, lesson 6). The next stage's range loop then ends by itself.
+	-parallelism      : a stage can run N goroutines reading from the same inbound channel
+	-errors           : the first error cancels the whole pipeline and is returned by Wait. The other errors are dropped.
+	-cancellation     : every send also waits on ctx.Done(), so no goroutine is left blocked when the pipeline stops early
+
+Note: with more than one goroutine in a stage, results come out in the order the goroutines finish, not in input order.
+
+*/
+
+// Pipeline owns the context and the goroutines of all its stages
+type Pipeline struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	errOnce sync.Once
+	err     error //the first error, set once by fail
+}
+
+// NewPipeline returns a pipeline whose stages stop when ctx is cancelled
+func NewPipeline(ctx context.Context) *Pipeline {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Pipeline{ctx: ctx, cancel: cancel}
+}
+
+// fail records the first error and stops every stage
+func (p *Pipeline) fail(err error) {
+	p.errOnce.Do(func() { p.err = err })
+	p.cancel()
+}
+
+// Wait blocks until every stage has finished and returns the first error, if any.
+// If the context given to NewPipeline was cancelled, that is reported as an error too.
+func (p *Pipeline) Wait() error {
+	p.wg.Wait() //after this no goroutine of the pipeline can call fail, so reading p.err is safe
+	err := p.err
+	if err == nil {
+		err = p.ctx.Err()
+	}
+	p.cancel() //release the context's resources
+	return err
+}
+
+// send waits until v is taken or the pipeline stops. It reports whether the value was sent.
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Source starts the first stage. gen calls emit for every value; emit returns false once the pipeline has stopped.
+func Source[T any](p *Pipeline, gen func(ctx context.Context, emit func(T) bool) error) <-chan T {
+	out := make(chan T)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(out)
+		if err := gen(p.ctx, func(v T) bool { return send(p.ctx, out, v) }); err != nil {
+			p.fail(err)
+		}
+	}()
+	return out
+}
+
+// FromSlice is a Source that sends the elements of s in order
+func FromSlice[T any](p *Pipeline, s []T) <-chan T {
+	return Source(p, func(ctx context.Context, emit func(T) bool) error {
+		for _, v := range s {
+			if !emit(v) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// Stage runs fn on every value from in, using 'workers' goroutines
+func Stage[In, Out any](p *Pipeline, in <-chan In, workers int, fn func(context.Context, In) (Out, error)) <-chan Out {
+	if workers < 1 {
+		workers = 1
+	}
+	out := make(chan Out)
+
+	var stageWG sync.WaitGroup
+	stageWG.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer stageWG.Done()
+			for v := range in {
+				r, err := fn(p.ctx, v)
+				if err != nil {
+					p.fail(err)
+					return
+				}
+				if !send(p.ctx, out, r) {
+					return
+				}
+			}
+		}()
+	}
+
+	//one extra goroutine closes 'out' once ALL the workers of this stage are done. No worker can close it itself: the others may still be sending.
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		stageWG.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// Sink is the last stage: it folds everything from in into one value. It runs in the caller's goroutine and returns when in is closed.
+// After a stage stops early (error or cancellation) Sink drains in, so that nothing upstream stays blocked.
+func Sink[T, R any](p *Pipeline, in <-chan T, init R, fold func(R, T) R) (R, error) {
+	acc := init
+	for v := range in {
+		if p.ctx.Err() == nil {
+			acc = fold(acc, v)
+		}
+	}
+	if err := p.Wait(); err != nil {
+		var zero R
+		return zero, err
+	}
+	return acc, nil
+}
+
+//-------THE PIECES FROM LESSON 6
+
+// fibonacci as a pipeline source: the quit channel is replaced by emit returning false
+func fibonacci(n int) func(context.Context, func(int) bool) error {
+	return func(ctx context.Context, emit func(int) bool) error {
+		x, y := 0, 1
+		for i := 0; i < n; i++ {
+			if !emit(x) {
+				return nil
+			}
+			x, y = y, x+y
+		}
+		return nil
+	}
+}
+
+// sliceSum as a pipeline stage: a slice comes in, its sum goes out. No channel parameter any more, the pipeline does the sending.
+func sliceSum(ctx context.Context, thisSlice []int) (int, error) {
+	sum := 0
+	for _, val := range thisSlice {
+		sum += val
+	}
+	return sum, nil
+}
+
+func square(ctx context.Context, n int) (int, error) {
+	return n * n, nil
+}
+
+var errTooBig = errors.New("number too big to square safely")
+
+func add(a, b int) int { return a + b }
+
+func main() {
+
+	//-------generator -> square -> sum (the reference pipeline)
+	p := NewPipeline(context.Background())
+	nums := Source(p, fibonacci(10))
+	squares := Stage(p, nums, 3, square) //3 goroutines squaring at the same time
+	total, err := Sink(p, squares, 0, add)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("sum of the squares of the first 10 fibonacci numbers:", total) //= fib(9)*fib(10) = 34*55
+
+	//-------lesson 6's split sum as a pipeline: slices -> sliceSum -> sum
+	primes := []int{2, 3, 5, 7, 11, 13}
+	p = NewPipeline(context.Background())
+	halves := FromSlice(p, [][]int{primes[:len(primes)/2], primes[len(primes)/2:]})
+	partials := Stage(p, halves, 2, sliceSum)
+	total, err = Sink(p, partials, 0, add)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Total:", total)
+
+	//-------ERRORS: the first error stops every stage, and no goroutine is left blocked
+	p = NewPipeline(context.Background())
+	nums = Source(p, fibonacci(100))
+	squares = Stage(p, nums, 3, func(ctx context.Context, n int) (int, error) {
+		if n > 1_000_000 {
+			return 0, fmt.Errorf("square %d: %w", n, errTooBig)
+		}
+		return n * n, nil
+	})
+	_, err = Sink(p, squares, 0, add)
+	fmt.Println("pipeline stopped:", err, "| errors.Is errTooBig:", errors.Is(err, errTooBig))
+
+	//-------CANCELLATION from outside: the context given to NewPipeline
+	ctx, cancel := context.WithCancel(context.Background())
+	p = NewPipeline(ctx)
+	endless := Source(p, func(ctx context.Context, emit func(int) bool) error {
+		for i := 0; emit(i); i++ {
+		}
+		return nil
+	})
+	seen := 0
+	_, err = Sink(p, endless, 0, func(acc, v int) int {
+		seen++
+		if seen == 1000 {
+			cancel()
+		}
+		return acc + v
+	})
+	fmt.Println("endless source stopped:", err)
+}
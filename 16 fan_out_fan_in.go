@@ -0,0 +1,207 @@
+//FAN-OUT / FAN-IN: spreading work over goroutines and merging the results, in order or not
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+
+In "6 concurrency_basics.go":
+
+	first, second := <-sumChan, <-sumChan
+
+Both goroutines send on the SAME channel, so first is whichever sum ARRIVED first, not the sum of the first half.
+Lesson 6 gets the labels right because each goroutine sends its number with its sum. This lesson makes that a tool for any number of goroutines:
+
+	-FAN-OUT : several goroutines read from one channel, sharing the work
+	-FAN-IN  : the outputs of several goroutines are merged back into one channel
+
+To put results back in order, every input gets a SEQUENCE NUMBER when it enters the fan-out (0, 1, 2, ...), and the number travels with the result.
+Merge then has two modes:
+	-Unordered : results are forwarded as soon as they arrive. Best throughput.
+	-Ordered   : results that arrive early are held back in a map until every result before them has been sent. Result i always comes out i-th.
+
+*/
+
+// Sequenced is a value together with the position of the input it came from
+type Sequenced[T any] struct {
+	Seq   int
+	Value T
+}
+
+// MergeMode selects how Merge orders its output
+type MergeMode int
+
+const (
+	Unordered MergeMode = iota
+	Ordered
+)
+
+func (m MergeMode) String() string {
+	if m == Ordered {
+		return "ordered"
+	}
+	return "unordered"
+}
+
+// Number tags every value from in with its position
+func Number[T any](ctx context.Context, in <-chan T) <-chan Sequenced[T] {
+	out := make(chan Sequenced[T])
+	go func() {
+		defer close(out)
+		seq := 0
+		for v := range in {
+			select {
+			case out <- Sequenced[T]{seq, v}:
+				seq++
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// FanOut starts 'workers' goroutines that share the inputs and apply fn. Each worker has its own output channel, closed when it is done.
+func FanOut[In, Out any](ctx context.Context, in <-chan Sequenced[In], workers int, fn func(In) Out) []<-chan Sequenced[Out] {
+	outs := make([]<-chan Sequenced[Out], workers)
+	for i := range outs {
+		out := make(chan Sequenced[Out])
+		outs[i] = out
+		go func() {
+			defer close(out)
+			for job := range in { //every worker ranges over the SAME channel: each value goes to exactly one of them
+				select {
+				case out <- Sequenced[Out]{job.Seq, fn(job.Value)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	return outs
+}
+
+// Merge fans in: it reads all the channels and sends everything on one channel, closed after the last input channel is closed
+func Merge[T any](ctx context.Context, mode MergeMode, ins ...<-chan Sequenced[T]) <-chan Sequenced[T] {
+	merged := make(chan Sequenced[T])
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+	for _, in := range ins {
+		go func() {
+			defer wg.Done()
+			for v := range in {
+				select {
+				case merged <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	if mode == Unordered {
+		return merged
+	}
+	return reorder(ctx, merged)
+}
+
+// reorder holds back early results until the one with the next sequence number shows up
+func reorder[T any](ctx context.Context, in <-chan Sequenced[T]) <-chan Sequenced[T] {
+	out := make(chan Sequenced[T])
+	go func() {
+		defer close(out)
+		next := 0
+		pending := make(map[int]T) //results that arrived too early, by sequence number
+		for v := range in {
+			pending[v.Seq] = v.Value
+			for {
+				value, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				select {
+				case out <- Sequenced[T]{next, value}:
+				case <-ctx.Done():
+					return
+				}
+				next++
+			}
+		}
+	}()
+	return out
+}
+
+// sliceSum from lesson 6 as a plain function. The first half is made slow on purpose, so it finishes LAST.
+func sliceSum(thisSlice []int) int {
+	if len(thisSlice) > 0 && thisSlice[0] == 2 { //the first half starts with 2. An empty slice has no first element: its sum is just 0
+		time.Sleep(50 * time.Millisecond)
+	}
+	sum := 0
+	for _, val := range thisSlice {
+		sum += val
+	}
+	return sum
+}
+
+func splitSum(mode MergeMode) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	primes := []int{2, 3, 5, 7, 11, 13}
+	halves := make(chan []int)
+	go func() {
+		defer close(halves)
+		halves <- primes[:len(primes)/2]
+		halves <- primes[len(primes)/2:]
+	}()
+
+	results := Merge(ctx, mode, FanOut(ctx, Number(ctx, halves), 2, sliceSum)...)
+
+	fmt.Println("-----", mode)
+	arrival, total := 0, 0
+	for r := range results {
+		//r.Seq says which half the sum belongs to, so the label is always right. Only the arrival order changes with the mode.
+		arrival++
+		fmt.Printf("arrived #%d: Partial Sum%d = %d\n", arrival, r.Seq+1, r.Value)
+		total += r.Value
+	}
+	fmt.Println("Total:", total)
+}
+
+func main() {
+	splitSum(Unordered)
+	splitSum(Ordered)
+
+	//-------many jobs: the unordered output order depends on timing, the ordered one never does
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, mode := range []MergeMode{Unordered, Ordered} {
+		nums := make(chan int)
+		go func() {
+			defer close(nums)
+			for i := 0; i < 10; i++ {
+				nums <- i
+			}
+		}()
+		slowSquare := func(n int) int {
+			time.Sleep(time.Duration(10-n) * 3 * time.Millisecond) //later inputs finish sooner
+			return n * n
+		}
+		fmt.Printf("%-9s:", mode)
+		for r := range Merge(ctx, mode, FanOut(ctx, Number(ctx, nums), 4, slowSquare)...) {
+			fmt.Printf(" %d", r.Value)
+		}
+		fmt.Println()
+	}
+}
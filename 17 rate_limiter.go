@@ -0,0 +1,359 @@
+//RATE LIMITER AND SCHEDULER: the tick/boom loop of lesson 6 without busy waiting
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+
+The SELECT & FOR loop in "6 concurrency_basics.go" has two problems:
+	-time.Tick gives no way to stop its ticker (before Go 1.23 it was never garbage collected, a leak)
+	-the default case runs whenever nothing else is ready, and then sleeps 50ms. The loop keeps waking up to print "def ." even though there is nothing to do: BUSY WAITING (polling).
+	 Without the default case, select simply blocks until a channel is ready, and the goroutine uses no CPU at all while it waits.
+
+This lesson builds two small tools and then rewrites the loop with them:
+	-TokenBucket : a RATE LIMITER. A bucket holds up to 'burst' tokens and is refilled at 'rate' tokens per second. Every action takes one token.
+	               A quiet caller saves up tokens and may then do 'burst' actions at once; over a long time it can never do more than 'rate' per second.
+	-Every       : a cancellable PERIODIC SCHEDULER. Calls a function every interval until its context is cancelled.
+
+Both read the time through a Clock interface instead of calling time.Now and time.NewTimer directly. In a program we pass the real clock.
+To check them we pass a FakeClock whose time only moves when we call Advance. Then "10 seconds later" takes no time and gives exactly the same answer on every run.
+
+*/
+
+//-------THE CLOCK
+
+// Clock is everything the limiter and scheduler need to know about time
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the part of *time.Timer we use
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// RealClock is the clock on the wall
+type RealClock struct{}
+
+func (RealClock) Now() time.Time { return time.Now() }
+
+func (RealClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (r realTimer) C() <-chan time.Time { return r.t.C }
+func (r realTimer) Stop() bool          { return r.t.Stop() }
+
+// FakeClock only moves forward when Advance is called
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond //signalled whenever a timer is created, see BlockUntilTimers
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	c     chan time.Time
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	f := &FakeClock{now: start}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *FakeClock) NewTimer(d time.Duration) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTimer{clock: f, when: f.now.Add(d), c: make(chan time.Time, 1)} //buffered like time.Timer's channel: firing never blocks
+	if d <= 0 {
+		t.c <- f.now
+	} else {
+		f.timers = append(f.timers, t)
+	}
+	f.cond.Broadcast()
+	return t
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	f := t.clock
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, other := range f.timers {
+		if other == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false //already fired or stopped
+}
+
+// Advance moves time forward and fires every timer that is due
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	pending := f.timers[:0]
+	for _, t := range f.timers {
+		if t.when.After(f.now) {
+			pending = append(pending, t)
+		} else {
+			t.c <- f.now
+		}
+	}
+	f.timers = pending
+}
+
+// BlockUntilTimers waits until n timers are waiting to fire. Use it before Advance, so that a goroutine has had time to start its timer.
+func (f *FakeClock) BlockUntilTimers(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.timers) < n {
+		f.cond.Wait()
+	}
+}
+
+//-------TOKEN BUCKET
+
+type TokenBucket struct {
+	clock Clock
+	rate  float64 //tokens added per second
+	burst float64 //capacity of the bucket
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time //when tokens was last brought up to date
+}
+
+// NewTokenBucket returns a FULL bucket: the first 'burst' actions are allowed right away.
+// rate must be more than 0 and burst at least 1, otherwise Wait could never get a token. Anything else is a bug in the caller, so it panics.
+func NewTokenBucket(clock Clock, rate float64, burst int) *TokenBucket {
+	if !(rate > 0) || burst < 1 { //!(rate > 0) also catches NaN
+		panic(fmt.Sprintf("token bucket: rate must be more than 0 and burst at least 1, got rate %v and burst %d", rate, burst))
+	}
+	return &TokenBucket{clock: clock, rate: rate, burst: float64(burst), tokens: float64(burst), last: clock.Now()}
+}
+
+// refill adds the tokens earned since the last call. Tokens are computed when needed: no goroutine has to add them one by one.
+func (b *TokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// Allow takes a token if there is one. It never blocks.
+func (b *TokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(b.clock.Now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+	return false
+}
+
+// Wait blocks until a token is available or ctx is done. It sleeps on a timer for exactly as long as needed: no polling.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		b.refill(b.clock.Now())
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		missing := 1 - b.tokens
+		b.mu.Unlock()
+
+		t := b.clock.NewTimer(time.Duration(missing / b.rate * float64(time.Second)))
+		select {
+		case <-t.C():
+			//loop: another goroutine may have taken the token in the meantime
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+//-------PERIODIC SCHEDULER
+
+// Every calls fn every interval until ctx is cancelled. The returned channel is closed once the scheduler has stopped.
+// Each tick is scheduled from the START time (start+interval, start+2*interval, ...) so a slow fn does not make the schedule drift.
+// If fn takes longer than an interval, the ticks it missed are skipped rather than run back to back.
+func Every(ctx context.Context, clock Clock, interval time.Duration, fn func(time.Time)) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		next := clock.Now().Add(interval)
+		for {
+			t := clock.NewTimer(next.Sub(clock.Now()))
+			select {
+			case now := <-t.C():
+				fn(now)
+				for !next.After(clock.Now()) {
+					next = next.Add(interval)
+				}
+			case <-ctx.Done():
+				t.Stop()
+				return
+			}
+		}
+	}()
+	return done
+}
+
+//-------CHECKS with the fake clock
+
+var errCheck = errors.New("check failed")
+
+func check(ok bool, format string, args ...any) error {
+	if !ok {
+		return fmt.Errorf("%w: "+format, append([]any{errCheck}, args...)...)
+	}
+	fmt.Printf("ok: "+format+"\n", args...)
+	return nil
+}
+
+func checkBurst() error {
+	clock := NewFakeClock(time.Unix(0, 0))
+	b := NewTokenBucket(clock, 10, 5) //10 per second, bursts of up to 5
+
+	allowed := 0
+	for i := 0; i < 20; i++ { //20 requests in the same instant
+		if b.Allow() {
+			allowed++
+		}
+	}
+	if err := check(allowed == 5, "burst: %d of 20 simultaneous requests allowed (want 5)", allowed); err != nil {
+		return err
+	}
+
+	clock.Advance(time.Minute) //a long quiet time refills the bucket, but never beyond 'burst'
+	allowed = 0
+	for i := 0; i < 20; i++ {
+		if b.Allow() {
+			allowed++
+		}
+	}
+	return check(allowed == 5, "burst after a quiet minute: %d allowed (want 5, the bucket does not overflow)", allowed)
+}
+
+func checkSteadyState() error {
+	clock := NewFakeClock(time.Unix(0, 0))
+	b := NewTokenBucket(clock, 10, 5)
+
+	//a greedy caller: every 100ms, for 10 seconds, it takes every token there is
+	allowed := 0
+	for step := 0; step <= 100; step++ {
+		for b.Allow() {
+			allowed++
+		}
+		clock.Advance(100 * time.Millisecond)
+	}
+	//5 from the initial burst, then 10 per second (one per 100ms)
+	return check(allowed == 5+100, "steady state: %d allowed in 10s at 10/s with burst 5 (want 105)", allowed)
+}
+
+func checkScheduler() error {
+	clock := NewFakeClock(time.Unix(0, 0))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ticks := make(chan time.Time, 100)
+	done := Every(ctx, clock, 100*time.Millisecond, func(t time.Time) { ticks <- t })
+	for i := 0; i < 5; i++ {
+		clock.BlockUntilTimers(1) //wait for the scheduler goroutine to set its timer
+		clock.Advance(100 * time.Millisecond)
+		<-ticks
+	}
+	cancel()
+	<-done
+	clock.Advance(time.Second) //after cancel, nothing fires any more
+	return check(len(ticks) == 0, "scheduler: 5 ticks in 500ms, none after cancel")
+}
+
+// checkBadBucket makes sure a bucket that could never give a token is refused right away, instead of making Wait spin or block forever
+func checkBadBucket() error {
+	refused := 0
+	cases := []struct {
+		rate  float64
+		burst int
+	}{{0, 5}, {-1, 5}, {math.NaN(), 5}, {10, 0}, {10, -1}}
+	for _, c := range cases {
+		func() {
+			defer func() {
+				if recover() != nil {
+					refused++
+				}
+			}()
+			NewTokenBucket(NewFakeClock(time.Unix(0, 0)), c.rate, c.burst)
+		}()
+	}
+	return check(refused == len(cases), "bad buckets: %d of %d refused (rate <= 0 or burst < 1)", refused, len(cases))
+}
+
+func main() {
+
+	for _, c := range []func() error{checkBurst, checkSteadyState, checkScheduler, checkBadBucket} {
+		if err := c(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	//-------THE TICK/BOOM LOOP, rewritten
+	/*
+		-tick : Every, stopped by cancelling ctx (no leaked ticker)
+		-boom : a timer from the same clock
+		-no default case: main sleeps inside select until boom, it never wakes up just to check
+	*/
+	var clock Clock = RealClock{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := Every(ctx, clock, 100*time.Millisecond, func(time.Time) {
+		fmt.Println("tick.")
+	})
+	boom := clock.NewTimer(500 * time.Millisecond)
+
+	select {
+	case <-boom.C():
+		fmt.Println("BOOM!")
+	case <-done: //only if the scheduler stopped on its own
+	}
+	cancel()
+	<-done
+	fmt.Println("loop EXITED without busy waiting")
+
+	//-------RATE LIMITING a loop: 20 requests at 20 per second, bursts of 5
+	limiter := NewTokenBucket(clock, 20, 5)
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	//the first 5 go through at once, the other 15 at 20 per second: about 750ms
+	fmt.Println("20 requests took", time.Since(start).Round(10*time.Millisecond))
+}
@@ -0,0 +1,337 @@
+//PUBLISH/SUBSCRIBE: one message, many receivers, built on channels
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+/*
+
+stringChan and mapChan in "6 concurrency_basics.go" are POINT TO POINT: every value sent is received by exactly ONE goroutine.
+Often we want BROADCAST instead: a "leave approved" event should reach the payroll goroutine AND the calendar goroutine AND the email goroutine.
+
+A PUBLISH/SUBSCRIBE broker does that:
+	-subscribers Subscribe to a TOPIC and get their own buffered channel
+	-a publisher Publishes a message on a topic, and the broker copies it into the channel of every subscriber of that topic
+	-Unsubscribe removes a subscriber and closes its channel, so its range loop ends
+
+The hard question: what if one subscriber is SLOW and its buffer is full? Each subscriber picks a policy:
+	-DropOldest : throw away the oldest message in the buffer to make room. The subscriber always sees the most recent messages.
+	-DropNewest : throw away the new message. The subscriber sees the first messages and misses the rest.
+	-Block      : the publisher waits until there is room. Nothing is lost, but one slow subscriber slows down everybody.
+	-Disconnect : the subscriber is unsubscribed. Its Err() says why.
+
+*/
+
+// Policy says what happens when a subscriber's buffer is full
+type Policy int
+
+const (
+	DropOldest Policy = iota
+	DropNewest
+	Block
+	Disconnect
+)
+
+func (p Policy) String() string {
+	return [...]string{"DropOldest", "DropNewest", "Block", "Disconnect"}[p]
+}
+
+var (
+	ErrSlowConsumer = errors.New("disconnected: subscriber too slow")
+	ErrUnsubscribed = errors.New("unsubscribed")
+)
+
+// Subscription is one subscriber's end of a topic
+type Subscription[T any] struct {
+	broker *Broker[T]
+	topic  string
+	policy Policy
+	ch     chan T
+
+	mu      sync.Mutex    //serializes deliveries to this subscriber, and closing ch
+	done    chan struct{} //closed first on unsubscribe, so that a publisher blocked in deliver gives up
+	once    sync.Once
+	err     error
+	dropped int
+}
+
+// C is the channel to receive messages from. It is closed after Unsubscribe or a disconnect.
+func (s *Subscription[T]) C() <-chan T { return s.ch }
+
+// Err says why the channel was closed, nil while still subscribed
+func (s *Subscription[T]) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Dropped counts the messages this subscriber lost because of DropOldest or DropNewest
+func (s *Subscription[T]) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (s *Subscription[T]) Unsubscribe() {
+	s.close(ErrUnsubscribed)
+}
+
+func (s *Subscription[T]) close(reason error) {
+	s.once.Do(func() {
+		s.broker.remove(s)
+		close(s.done) //wake a publisher blocked on this subscriber (Block policy)...
+		s.mu.Lock()   //...so that it lets go of mu and we can safely close ch: no send can be in progress now
+		s.err = reason
+		close(s.ch)
+		s.mu.Unlock()
+	})
+}
+
+// deliver puts msg in the subscriber's buffer following its policy. It reports whether msg was delivered.
+func (s *Subscription[T]) deliver(msg T) bool {
+	s.mu.Lock()
+	if s.err != nil { //closed while the publisher was looking at the subscriber list
+		s.mu.Unlock()
+		return false
+	}
+
+	select {
+	case s.ch <- msg: //room in the buffer: every policy does the same thing
+		s.mu.Unlock()
+		return true
+	default:
+	}
+
+	switch s.policy {
+	case DropOldest:
+		select {
+		case <-s.ch: //take out the oldest one ourselves...
+			s.dropped++
+		default: //...unless the subscriber just emptied a slot
+		}
+		s.ch <- msg //cannot block: we hold mu, so no other publisher can fill the slot we just made
+		s.mu.Unlock()
+		return true
+	case DropNewest:
+		s.dropped++
+		s.mu.Unlock()
+		return false
+	case Block:
+		defer s.mu.Unlock()
+		select {
+		case s.ch <- msg:
+			return true
+		case <-s.done:
+			return false
+		}
+	}
+
+	//Disconnect. close needs mu, so let go of it first
+	s.mu.Unlock()
+	s.close(ErrSlowConsumer)
+	return false
+}
+
+// Broker keeps the subscribers of every topic
+type Broker[T any] struct {
+	mu     sync.RWMutex
+	topics map[string][]*Subscription[T]
+}
+
+func NewBroker[T any]() *Broker[T] {
+	return &Broker[T]{topics: make(map[string][]*Subscription[T])}
+}
+
+// Subscribe adds a subscriber to topic, with a buffer of 'buffer' messages
+func (b *Broker[T]) Subscribe(topic string, buffer int, policy Policy) *Subscription[T] {
+	if buffer < 1 && policy != Block {
+		buffer = 1 //an unbuffered channel is always "full" for the drop policies
+	}
+	s := &Subscription[T]{broker: b, topic: topic, policy: policy, ch: make(chan T, buffer), done: make(chan struct{})}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.topics[topic] = append(b.topics[topic], s)
+	return s
+}
+
+func (b *Broker[T]) remove(s *Subscription[T]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs := b.topics[s.topic]
+	if i := slices.Index(subs, s); i >= 0 {
+		//build a NEW slice: publishers may still be looping over the old one (see Publish)
+		b.topics[s.topic] = slices.Delete(slices.Clone(subs), i, i+1)
+	}
+}
+
+// Publish sends msg to every subscriber of topic and returns how many received it.
+// Many goroutines may publish at the same time.
+func (b *Broker[T]) Publish(topic string, msg T) int {
+	//copy the list under the read lock and deliver WITHOUT holding it: a Block subscriber could otherwise stop Subscribe and Unsubscribe for everyone
+	b.mu.RLock()
+	subs := b.topics[topic]
+	b.mu.RUnlock()
+
+	delivered := 0
+	for _, s := range subs {
+		if s.deliver(msg) {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+//-------CHECKS, one per policy: buffer of 2, five messages published while nobody reads
+
+func drain[T any](s *Subscription[T]) []T {
+	var got []T
+	for {
+		select {
+		case v, ok := <-s.C():
+			if !ok {
+				return got
+			}
+			got = append(got, v)
+		default:
+			return got
+		}
+	}
+}
+
+func checkPolicy(policy Policy, want []int, wantErr error) error {
+	b := NewBroker[int]()
+	s := b.Subscribe("leaves", 2, policy)
+	for i := 1; i <= 5; i++ {
+		b.Publish("leaves", i)
+	}
+	got := drain(s)
+	if !slices.Equal(got, want) || !errors.Is(s.Err(), wantErr) {
+		return fmt.Errorf("%v: got %v (err %v), want %v (err %v)", policy, got, s.Err(), want, wantErr)
+	}
+	fmt.Printf("ok: %-10v received %v, dropped %d, err %v\n", policy, got, s.Dropped(), s.Err())
+	return nil
+}
+
+func checkBlock() error {
+	b := NewBroker[int]()
+	s := b.Subscribe("leaves", 2, Block)
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 1; i <= 5; i++ {
+			b.Publish("leaves", i) //blocks on the 3rd message until the subscriber reads
+		}
+	}()
+
+	select {
+	case <-published:
+		return errors.New("Block: publisher did not block on a full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	var got []int
+	for v := range s.C() {
+		got = append(got, v)
+		if len(got) == 5 {
+			break
+		}
+	}
+	<-published
+	if !slices.Equal(got, []int{1, 2, 3, 4, 5}) {
+		return fmt.Errorf("Block: got %v", got)
+	}
+	fmt.Printf("ok: %-10v received %v, publisher waited for the slow subscriber\n", Block, got)
+
+	//Unsubscribe must also free a publisher that is blocked on this subscriber
+	for i := 0; i < 2; i++ {
+		b.Publish("leaves", i) //fill the buffer
+	}
+	freed := make(chan int)
+	go func() { freed <- b.Publish("leaves", 99) }()
+	time.Sleep(10 * time.Millisecond)
+	s.Unsubscribe()
+	if n := <-freed; n != 0 {
+		return fmt.Errorf("Block: message delivered to an unsubscribed subscriber")
+	}
+	fmt.Println("ok: Unsubscribe releases a blocked publisher")
+	return nil
+}
+
+// checkConcurrent publishes from many goroutines at once while subscribers come and go. Run with -race.
+func checkConcurrent() error {
+	b := NewBroker[int]()
+	keep := b.Subscribe("leaves", 1000, Block)
+
+	var wg sync.WaitGroup
+	for p := 0; p < 10; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				b.Publish("leaves", i)
+			}
+		}()
+	}
+	for c := 0; c < 10; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := b.Subscribe("leaves", 1, DropOldest)
+			time.Sleep(time.Millisecond)
+			s.Unsubscribe()
+		}()
+	}
+	wg.Wait()
+
+	if n := len(keep.C()); n != 1000 {
+		return fmt.Errorf("concurrent: %d messages, want 1000", n)
+	}
+	fmt.Println("ok: 10 concurrent publishers, 1000 messages, subscribers joining and leaving")
+	return nil
+}
+
+func main() {
+	checks := []func() error{
+		func() error { return checkPolicy(DropOldest, []int{4, 5}, nil) },
+		func() error { return checkPolicy(DropNewest, []int{1, 2}, nil) },
+		func() error { return checkPolicy(Disconnect, []int{1, 2}, ErrSlowConsumer) },
+		checkBlock,
+		checkConcurrent,
+	}
+	for _, c := range checks {
+		if err := c(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	//-------A BROADCAST: one leave approval, three listeners
+	b := NewBroker[string]()
+	var wg sync.WaitGroup
+	var subs []*Subscription[string]
+	for _, name := range []string{"payroll", "calendar", "email"} {
+		s := b.Subscribe("leave.approved", 10, Block)
+		subs = append(subs, s)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range s.C() { //ends when Unsubscribe closes the channel
+				fmt.Printf("%-8s got: %s\n", name, msg)
+			}
+		}()
+	}
+	fmt.Println("delivered to", b.Publish("leave.approved", "Sam Adolf, 3 days"), "subscribers")
+	fmt.Println("delivered to", b.Publish("leave.rejected", "nobody listens to this topic"), "subscribers")
+
+	for _, s := range subs {
+		s.Unsubscribe()
+	}
+	wg.Wait()
+}
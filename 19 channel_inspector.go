@@ -0,0 +1,351 @@
+//CHANNEL INSPECTOR: looking inside a channel while it is being used
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+
+"6 concurrency_basics.go" explains len() and cap() of a channel in words. Here we watch them change.
+
+Go only lets you ask a channel two questions: len(ch) (values waiting in the buffer) and cap(ch) (size of the buffer).
+It will NOT tell you whether a channel is closed (without receiving from it) or how many goroutines are stuck on it.
+So the Inspector WRAPS a channel: every send, receive and close goes through its methods, and it keeps count on the way:
+	-len, cap      : straight from the channel
+	-closed        : remembered when Close is called
+	-blocked       : how many goroutines are waiting in Send or Recv right now
+	-timeline      : every operation with a timestamp and the len right after it
+	-Diagram()     : a picture of the buffer, e.g.  [ 0 | 1 | 2 |   |   ]  len=3 cap=5
+
+*/
+
+// Event is one entry of the timeline
+type Event struct {
+	At    time.Duration //since the inspector was created
+	Op    string        //"send", "recv", "recv (closed)" or "close"
+	Value any
+	Len   int //len(ch) just after the operation
+}
+
+// Inspector wraps a channel of T
+type Inspector[T any] struct {
+	name  string
+	ch    chan T
+	start time.Time
+
+	mu   sync.Mutex
+	cond *sync.Cond //broadcast after every operation, so that blocked goroutines check again
+
+	closed           bool
+	blockedSenders   int
+	blockedReceivers int
+	timeline         []Event
+	//values mirrors what is in the buffer, in order, so that Diagram can draw it.
+	//For a BUFFERED channel every operation is done under mu, so the mirror is always exact.
+	values []T
+}
+
+// Inspect makes a channel with the given capacity (0 = unbuffered) and wraps it
+func Inspect[T any](name string, capacity int) *Inspector[T] {
+	in := &Inspector[T]{name: name, ch: make(chan T, capacity), start: time.Now()}
+	in.cond = sync.NewCond(&in.mu)
+	return in
+}
+
+func (in *Inspector[T]) record(op string, v any) {
+	in.timeline = append(in.timeline, Event{At: time.Since(in.start), Op: op, Value: v, Len: len(in.ch)})
+	in.cond.Broadcast()
+}
+
+/*
+How blocking is counted:
+	-buffered channel: the inspector only ever does NON-blocking operations (select with default) while holding mu.
+	 When one cannot happen yet, the goroutine is counted as blocked and sleeps on cond until some other operation changes the channel, then tries again.
+	-unbuffered channel: a send can only happen together with a receive, so the inspector has to do a real blocking operation. It counts the goroutine as blocked around it.
+*/
+
+// Send is ch <- v. Sending on a closed channel panics, exactly like the real thing.
+func (in *Inspector[T]) Send(v T) {
+	in.mu.Lock()
+	if cap(in.ch) == 0 {
+		in.sendUnbuffered(v)
+		return
+	}
+	defer in.mu.Unlock()
+
+	blocked := false
+	defer func() {
+		if blocked {
+			in.blockedSenders-- //also when the send panics because Close ran while we were waiting
+		}
+	}()
+	for {
+		select {
+		case in.ch <- v:
+			in.values = append(in.values, v)
+			in.record("send", v)
+			return
+		default:
+		}
+		if !blocked {
+			blocked = true
+			in.blockedSenders++
+		}
+		in.cond.Wait() //buffer full: sleep until something is received
+	}
+}
+
+// sendUnbuffered is called with mu held and releases it for the real send.
+// Nothing is deferred on mu before that, so a panicking send (closed channel) cannot unlock it twice.
+func (in *Inspector[T]) sendUnbuffered(v T) {
+	in.blockedSenders++
+	in.mu.Unlock()
+
+	sent := false
+	defer func() {
+		in.mu.Lock()
+		defer in.mu.Unlock()
+		in.blockedSenders--
+		if sent {
+			in.record("send", v)
+		}
+	}()
+	in.ch <- v
+	sent = true
+}
+
+// Recv is v, ok := <-ch
+func (in *Inspector[T]) Recv() (T, bool) {
+	in.mu.Lock()
+	if cap(in.ch) == 0 {
+		return in.recvUnbuffered()
+	}
+	defer in.mu.Unlock()
+
+	for waiting := false; ; waiting = true {
+		select {
+		case v, ok := <-in.ch:
+			if waiting {
+				in.blockedReceivers--
+			}
+			in.received(v, ok)
+			return v, ok
+		default:
+		}
+		if !waiting {
+			in.blockedReceivers++
+		}
+		in.cond.Wait() //buffer empty: sleep until something is sent or the channel is closed
+	}
+}
+
+// recvUnbuffered is called with mu held, like sendUnbuffered
+func (in *Inspector[T]) recvUnbuffered() (T, bool) {
+	in.blockedReceivers++
+	in.mu.Unlock()
+	v, ok := <-in.ch
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.blockedReceivers--
+	in.received(v, ok)
+	return v, ok
+}
+
+func (in *Inspector[T]) received(v T, ok bool) {
+	if !ok {
+		in.record("recv (closed)", nil)
+		return
+	}
+	if len(in.values) > 0 {
+		in.values = in.values[1:] //a buffered channel is a FIFO queue: the first value in is the first one out
+	}
+	in.record("recv", v)
+}
+
+// Close is close(ch). Closing twice panics, exactly like the real thing.
+func (in *Inspector[T]) Close() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	close(in.ch)
+	in.closed = true
+	in.record("close", nil)
+}
+
+// Range calls fn for every value until the channel is closed and empty, like: for v := range ch
+func (in *Inspector[T]) Range(fn func(T)) {
+	for {
+		v, ok := in.Recv()
+		if !ok {
+			return
+		}
+		fn(v)
+	}
+}
+
+// State is a snapshot of what the inspector knows
+type State struct {
+	Len, Cap                         int
+	Closed                           bool
+	BlockedSenders, BlockedReceivers int
+}
+
+func (in *Inspector[T]) State() State {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return State{
+		Len:              len(in.ch),
+		Cap:              cap(in.ch),
+		Closed:           in.closed,
+		BlockedSenders:   in.blockedSenders,
+		BlockedReceivers: in.blockedReceivers,
+	}
+}
+
+func (s State) String() string {
+	return fmt.Sprintf("len=%d cap=%d closed=%v blocked senders=%d blocked receivers=%d", s.Len, s.Cap, s.Closed, s.BlockedSenders, s.BlockedReceivers)
+}
+
+// maxCells is how many buffer slots Diagram draws before it shortens the picture with "..."
+const maxCells = 12
+
+// Diagram draws the buffer: filled slots show their value, empty slots are blank
+func (in *Inspector[T]) Diagram() string {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	c := cap(in.ch)
+	var b strings.Builder
+	b.WriteString(in.name + ": ")
+	if c == 0 {
+		b.WriteString("[] unbuffered: every send waits for a receiver")
+	} else {
+		cells := make([]string, 0, maxCells+1)
+		for i := 0; i < c && i < maxCells; i++ {
+			cell := ""
+			if i < len(in.values) {
+				cell = fmt.Sprint(in.values[i])
+			}
+			cells = append(cells, fmt.Sprintf("%3s", cell))
+		}
+		if c > maxCells {
+			cells = append(cells, fmt.Sprintf("... %d more", c-maxCells))
+		}
+		b.WriteString("[" + strings.Join(cells, " |") + " ]")
+	}
+	fmt.Fprintf(&b, "  len=%d cap=%d", len(in.ch), c)
+	if in.closed {
+		b.WriteString(" CLOSED")
+	}
+	return b.String()
+}
+
+// PrintTimeline prints the recorded operations
+func (in *Inspector[T]) PrintTimeline() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	fmt.Printf("timeline of %s:\n", in.name)
+	for _, e := range in.timeline {
+		value := ""
+		if e.Value != nil {
+			value = fmt.Sprint(e.Value)
+		}
+		fmt.Printf("  %8s  %-14s %-8s len=%d\n", e.At.Round(time.Microsecond), e.Op, value, e.Len)
+	}
+}
+
+func main() {
+
+	//-------queueChan from lesson 6
+	queueChan := Inspect[string]("queueChan", 2)
+	fmt.Println(queueChan.Diagram())
+	queueChan.Send("first")
+	fmt.Println(queueChan.Diagram())
+	queueChan.Send("second")
+	fmt.Println(queueChan.Diagram(), " <- full: a third Send would block")
+	queueChan.Close()
+	fmt.Println(queueChan.Diagram(), " <- closed, but the values are still there to receive")
+	queueChan.Range(func(elem string) {
+		fmt.Println(elem, "->", queueChan.Diagram())
+	})
+	fmt.Println(queueChan.State())
+	queueChan.PrintTimeline()
+
+	//-------bufferedChan from lesson 6: 50 values in a buffer of 100
+	bufferedChan := Inspect[int]("bufferedChan", 100)
+	for s := 0; s < 50; s++ {
+		bufferedChan.Send(s)
+	}
+	fmt.Println(bufferedChan.Diagram())
+	fmt.Println(bufferedChan.State())
+	bufferedChan.Close()
+	sum := 0
+	bufferedChan.Range(func(val int) { sum += val })
+	fmt.Println("sum of received values:", sum, "|", bufferedChan.State())
+
+	//-------BLOCKED goroutines: a full buffer and an empty one
+	small := Inspect[int]("small", 1)
+	small.Send(1)
+	var wg sync.WaitGroup
+	for i := 2; i <= 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			small.Send(i) //the buffer is full: these two block
+		}()
+	}
+	time.Sleep(20 * time.Millisecond) //give them time to get stuck
+	fmt.Println(small.Diagram(), "|", small.State())
+	for i := 0; i < 3; i++ {
+		small.Recv() //every receive makes room for one blocked sender
+	}
+	wg.Wait()
+	fmt.Println(small.Diagram(), "|", small.State())
+
+	empty := Inspect[int]("empty", 0)
+	go empty.Recv() //nothing to receive: blocks
+	time.Sleep(20 * time.Millisecond)
+	fmt.Println(empty.Diagram(), "|", empty.State())
+	empty.Send(42)
+	time.Sleep(20 * time.Millisecond)
+	fmt.Println(empty.State())
+	empty.PrintTimeline()
+
+	//-------SEND ON A CLOSED CHANNEL panics like the real thing, and the inspector is still usable after recovering
+	for _, capacity := range []int{0, 2} {
+		name := fmt.Sprintf("closed (cap %d)", capacity)
+		closed := Inspect[int](name, capacity)
+		closed.Close()
+		fmt.Println(name, "send:", sendRecovered(closed, 1))
+		if st := closed.State(); st.BlockedSenders != 0 {
+			panic(fmt.Sprintf("%s: %v after the panic", name, st))
+		}
+	}
+
+	//a sender blocked on a full buffer panics when Close wakes it up
+	full := Inspect[int]("full", 1)
+	full.Send(1)
+	panicked := make(chan any)
+	go func() { panicked <- sendRecovered(full, 2) }()
+	for full.State().BlockedSenders == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	full.Close()
+	fmt.Println("full, blocked send woken by Close:", <-panicked)
+	if st := full.State(); st.BlockedSenders != 0 || st.Len != 1 {
+		panic(fmt.Sprintf("full: %v after the panic", st))
+	}
+	fmt.Println("ok: send on a closed channel panics and leaves the counts right")
+}
+
+// sendRecovered sends v and returns what Send panicked with (nil if it did not)
+func sendRecovered(in *Inspector[int], v int) (panicked any) {
+	defer func() { panicked = recover() }()
+	in.Send(v)
+	return nil
+}
@@ -0,0 +1,380 @@
+//CHECKED CHANNELS: running the channel mistakes of lesson 6 safely
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+/*
+
+"6 concurrency_basics.go" warns about three mistakes but cannot show them, because each one ends the program:
+	-ranging over a channel that is never closed         -> "fatal error: all goroutines are asleep - deadlock!"
+	-sending on a closed channel                         -> panic: send on closed channel
+	-closing a channel twice                             -> panic: close of closed channel
+
+Checked[T] behaves like a channel, but each of these mistakes is turned into an ERROR plus a REPORT with the stack traces of the goroutines involved.
+The lesson can then make every mistake on purpose, print what went wrong, and keep going.
+
+DEADLOCK DETECTION needs to know who is using the channel. Every goroutine that sends or receives calls Join once, and Leave when it is done (with defer).
+A deadlock is when EVERY participant that has not left is blocked on the channel: nobody is left who could ever unblock them.
+Go's own detector only fires when ALL goroutines of the whole program are asleep. This one fires for a single channel, even if the rest of the program is busy.
+
+The channel is built from a slice, a mutex and a sync.Cond instead of a real chan, so that every send and receive can be checked under one lock.
+An unbuffered Checked (capacity 0) still behaves like an unbuffered channel: Send returns only once a receiver has taken the value.
+
+*/
+
+var (
+	ErrSendOnClosed = errors.New("send on closed channel")
+	ErrDoubleClose  = errors.New("close of closed channel")
+	ErrDeadlock     = errors.New("deadlock: every participant is blocked on the channel")
+)
+
+// Report describes one misuse
+type Report struct {
+	Channel string
+	Err     error
+	Stacks  []string //one per goroutine involved
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "=== %s: %v\n", r.Channel, r.Err)
+	for _, s := range r.Stacks {
+		b.WriteString(indent(s))
+	}
+	return b.String()
+}
+
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(strings.TrimSpace(s), "\n", "\n    ") + "\n"
+}
+
+// stack returns the stack trace of the calling goroutine without the top 'skip' frames, so that the report starts in the code that used the channel
+func stack(skip int) string {
+	buf := make([]byte, 8<<10)
+	buf = buf[:runtime.Stack(buf, false)]
+	lines := strings.Split(string(buf), "\n")
+	//lines[0] is "goroutine N [running]:", then two lines per frame (function, file:line). The first frame is stack itself.
+	drop := 2 * (skip + 1)
+	if len(lines) > 1+drop {
+		lines = append(lines[:1], lines[1+drop:]...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Checked is a channel of T with misuse and deadlock detection
+type Checked[T any] struct {
+	name     string
+	capacity int
+	onReport func(Report)
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	queue    []T
+	sent     int //number of values ever put in queue
+	received int //number of values ever taken out (for unbuffered sends: "has mine been taken yet?")
+
+	closed     bool
+	closeStack string
+
+	participants int
+	blocked      map[int]string //blocked goroutines: id -> stack when they blocked
+	nextID       int
+	deadlocked   bool
+}
+
+// NewChecked makes a checked channel. onReport is called for every misuse (with the channel locked, so it must not use the channel); nil prints the report.
+func NewChecked[T any](name string, capacity int, onReport func(Report)) *Checked[T] {
+	if onReport == nil {
+		onReport = func(r Report) { fmt.Print(r) }
+	}
+	c := &Checked[T]{name: name, capacity: capacity, onReport: onReport, blocked: make(map[int]string)}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Join registers the calling goroutine as a participant. Call Leave (usually with defer) when it stops using the channel.
+func (c *Checked[T]) Join() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.participants++
+}
+
+func (c *Checked[T]) Leave() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.participants--
+	c.checkDeadlock() //the one who left may have been the only one who could unblock the rest
+}
+
+// wait blocks the calling goroutine (mu held) until the channel changes. It returns ErrDeadlock if the channel is deadlocked.
+func (c *Checked[T]) wait(id int) error {
+	if !c.deadlocked {
+		c.blocked[id] = stack(2) //skip wait and the Send/Recv that called it
+		c.checkDeadlock()
+	}
+	if !c.deadlocked {
+		c.cond.Wait()
+	}
+	delete(c.blocked, id)
+	if c.deadlocked {
+		return ErrDeadlock
+	}
+	return nil
+}
+
+// changed wakes every blocked goroutine after a send, receive or close. They are no longer counted as blocked:
+// each one checks again and calls wait (and is counted again) only if it still cannot go on.
+func (c *Checked[T]) changed() {
+	clear(c.blocked)
+	c.cond.Broadcast()
+}
+
+// checkDeadlock is called with mu held whenever a goroutine blocks or leaves
+func (c *Checked[T]) checkDeadlock() {
+	if c.deadlocked || c.participants <= 0 || len(c.blocked) < c.participants {
+		return
+	}
+	c.deadlocked = true
+	r := Report{Channel: c.name, Err: ErrDeadlock}
+	for _, s := range c.blocked {
+		r.Stacks = append(r.Stacks, s)
+	}
+	c.onReport(r)
+	c.cond.Broadcast() //wake everyone: they all return ErrDeadlock
+}
+
+// Send is ch <- v
+func (c *Checked[T]) Send(v T) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	id := c.nextID
+
+	if c.closed {
+		return c.sendOnClosed()
+	}
+
+	//buffered: wait for room. Unbuffered (capacity 0): go straight into the queue and wait below until a receiver takes the value.
+	for c.capacity > 0 && len(c.queue) >= c.capacity {
+		if err := c.wait(id); err != nil {
+			return err
+		}
+		if c.closed {
+			return c.sendOnClosed() //Close ran while we were waiting for room
+		}
+	}
+	c.queue = append(c.queue, v)
+	c.sent++
+	mine := c.sent
+	c.changed()
+
+	for c.capacity == 0 && c.received < mine {
+		if c.closed {
+			return c.sendOnClosed() //Close ran before a receiver took the value, and took it back out of the queue
+		}
+		if err := c.wait(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendOnClosed reports a Send on the closed channel (mu held), with the sender's stack and the one that closed it
+func (c *Checked[T]) sendOnClosed() error {
+	c.onReport(Report{Channel: c.name, Err: ErrSendOnClosed, Stacks: []string{"send:\n" + stack(2), "closed by:\n" + c.closeStack}})
+	return ErrSendOnClosed
+}
+
+// Recv is v, ok := <-ch. ok is false once the channel is closed and empty.
+func (c *Checked[T]) Recv() (T, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	id := c.nextID
+
+	var zero T
+	for len(c.queue) == 0 {
+		if c.closed {
+			return zero, false, nil
+		}
+		if err := c.wait(id); err != nil {
+			return zero, false, err
+		}
+	}
+	v := c.queue[0]
+	c.queue = c.queue[1:]
+	c.received++
+	c.changed()
+	return v, true, nil
+}
+
+// Close is close(ch)
+func (c *Checked[T]) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		c.onReport(Report{Channel: c.name, Err: ErrDoubleClose, Stacks: []string{"second close:\n" + stack(1), "first close:\n" + c.closeStack}})
+		return ErrDoubleClose
+	}
+	c.closed = true
+	c.closeStack = stack(1)
+	if c.capacity == 0 {
+		//an unbuffered value waiting in the queue has not been sent yet: its sender fails, and no receiver may get it after the close
+		c.queue = nil
+	}
+	c.changed()
+	return nil
+}
+
+// Range is: for v := range ch. It returns the error that stopped it, nil when the channel was closed normally.
+func (c *Checked[T]) Range(fn func(T)) error {
+	for {
+		v, ok, err := c.Recv()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		fn(v)
+	}
+}
+
+//-------THE MISTAKES FROM LESSON 6, made on purpose
+
+// queueChan WITHOUT close(queueChan): the range loop never ends
+func rangeWithoutClose() {
+	queueChan := NewChecked[string]("queueChan", 2, nil)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	queueChan.Join() //join BEFORE starting the goroutine, so the receiver cannot look alone for a moment
+	go func() {
+		defer wg.Done()
+		defer queueChan.Leave()
+		queueChan.Send("first")
+		queueChan.Send("second")
+		//forgot: queueChan.Close()
+	}()
+
+	queueChan.Join()
+	defer queueChan.Leave()
+	err := queueChan.Range(func(elem string) { fmt.Println(elem) })
+	wg.Wait()
+	fmt.Println("Range stopped with:", err)
+	fmt.Println("EXPLANATION: the sender left without closing the channel. The range loop waits for a value or a close that can never come.")
+}
+
+// the same thing with close: no report
+func rangeWithClose() {
+	queueChan := NewChecked[string]("queueChan", 2, nil)
+	queueChan.Join()
+	go func() {
+		defer queueChan.Leave()
+		queueChan.Send("first")
+		queueChan.Send("second")
+		queueChan.Close()
+	}()
+	queueChan.Join()
+	defer queueChan.Leave()
+	err := queueChan.Range(func(elem string) { fmt.Println(elem) })
+	fmt.Println("Range stopped with:", err)
+}
+
+func sendAfterClose() {
+	intChan := NewChecked[int]("intChan", 1, nil)
+	intChan.Close()
+	err := intChan.Send(41)
+	fmt.Println("Send returned:", err)
+	fmt.Println("EXPLANATION: only the sender should close a channel, and only after its LAST send. Once closed, a channel can never be opened again.")
+}
+
+// a blocked sender when the channel is closed under it: waiting for room in a full buffer (capacity 1), or for a receiver (capacity 0)
+func closeWhileSendBlocked(capacity int) {
+	var reports []Report
+	intChan := NewChecked[int]("intChan", capacity, func(r Report) {
+		fmt.Print(r)
+		reports = append(reports, r) //onReport runs with the channel locked, and reports is only read after the sender is done
+	})
+	intChan.Join() //main takes part too, so that the blocked sender alone is not a deadlock
+	defer intChan.Leave()
+	for i := 0; i < capacity; i++ {
+		intChan.Send(1)
+	}
+
+	errc := make(chan error)
+	intChan.Join()
+	go func() {
+		defer intChan.Leave()
+		errc <- intChan.Send(2) //the buffer is full, or nobody receives: blocks
+	}()
+	for blocked := 0; blocked == 0; {
+		intChan.mu.Lock()
+		blocked = len(intChan.blocked)
+		intChan.mu.Unlock()
+		runtime.Gosched()
+	}
+	intChan.Close()
+	err := <-errc
+	fmt.Println("Send returned:", err)
+
+	//CHECK: the same report as a send after close, with the blocked sender's stack and the close's stack
+	if !errors.Is(err, ErrSendOnClosed) || len(reports) != 1 || reports[0].Err != ErrSendOnClosed || len(reports[0].Stacks) != 2 ||
+		!strings.HasPrefix(reports[0].Stacks[0], "send:\n") || !strings.Contains(reports[0].Stacks[0], "main.closeWhileSendBlocked.func") ||
+		!strings.HasPrefix(reports[0].Stacks[1], "closed by:\n") || !strings.Contains(reports[0].Stacks[1], "main.closeWhileSendBlocked(") {
+		panic(fmt.Sprintf("blocked send on close: err=%v reports=%v", err, reports))
+	}
+	//CHECK: receivers get what was really sent (the values in the buffer), never the 2
+	for i := 0; i <= capacity; i++ {
+		v, ok, err := intChan.Recv()
+		if err != nil || ok != (i < capacity) || (ok && v != 1) {
+			panic(fmt.Sprintf("recv %d after close: %d %v %v", i, v, ok, err))
+		}
+	}
+	fmt.Println("EXPLANATION: the value 2 was never sent. Closing a channel while someone may still send on it is the same mistake as sending after close.")
+}
+
+func doubleClose() {
+	boolChan := NewChecked[bool]("boolChan", 0, nil)
+	boolChan.Close()
+	err := boolChan.Close()
+	fmt.Println("Close returned:", err)
+	fmt.Println("EXPLANATION: when several goroutines might close a channel, let exactly one of them own it, or protect the close with sync.Once.")
+}
+
+// an unbuffered send with no receiver: the lesson 6 comment "if it was a default channel, there would have been blocking"
+func unbufferedSendNoReceiver() {
+	stringChan := NewChecked[string]("stringChan", 0, nil)
+	stringChan.Join()
+	defer stringChan.Leave()
+	err := stringChan.Send("nobody will receive this")
+	fmt.Println("Send returned:", err)
+	fmt.Println("EXPLANATION: an unbuffered send waits for a receiver. The only participant is the sender itself, so it waits forever.")
+}
+
+func main() {
+	for _, demo := range []struct {
+		title string
+		fn    func()
+	}{
+		{"range over a channel nobody closes", rangeWithoutClose},
+		{"range over a closed channel (correct)", rangeWithClose},
+		{"send after close", sendAfterClose},
+		{"close while a send waits for room", func() { closeWhileSendBlocked(1) }},
+		{"close while an unbuffered send waits for a receiver", func() { closeWhileSendBlocked(0) }},
+		{"close twice", doubleClose},
+		{"unbuffered send without a receiver", unbufferedSendNoReceiver},
+	} {
+		fmt.Println("-------", strings.ToUpper(demo.title))
+		demo.fn()
+	}
+	fmt.Println("------- the program is still running: no panic, no fatal error")
+}
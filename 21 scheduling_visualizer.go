@@ -0,0 +1,305 @@
+//SCHEDULING VISUALIZER: seeing why say("hello") and say("world") interleave differently every run
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+
+"5 go_threads.go" says the output of say("world") and say("hello") "will be most probably different for each execution". Why?
+Both goroutines sleep 100ms, wake up and print. They wake up at ALMOST the same moment, and which one the scheduler runs first is not defined.
+A few microseconds one way or the other swap the order of two lines.
+
+This lesson INSTRUMENTS say(): every step is recorded as an event with a timestamp
+	start -> sleep -> wake -> print -> sleep -> wake -> print ... -> end
+and the events are drawn as an ASCII SWIMLANE, one lane per goroutine, time going left to right:
+
+	hello  |S~~~~~~~~~P~~~~~~~~~P~~~~~~~~~P...
+	world  |S~~~~~~~~~~P~~~~~~~~~P~~~~~~~~P...
+
+	S start   ~ sleeping   P print   E end   (one column = -step, 10ms by default)
+
+Lanes show WHEN things happened. To see WHICH print came first when two land in the same column, read the event list below the diagram.
+
+The same events can be saved as Chrome TRACE EVENT JSON and opened in chrome://tracing or https://ui.perfetto.dev:
+	go run "21 scheduling_visualizer.go" -json say.json
+
+*/
+
+// EventKind is what happened
+type EventKind string
+
+const (
+	Start EventKind = "start"
+	Sleep EventKind = "sleep"
+	Wake  EventKind = "wake"
+	Print EventKind = "print"
+	End   EventKind = "end"
+)
+
+type Event struct {
+	Lane string //name of the goroutine
+	Kind EventKind
+	At   time.Duration //since the recorder started
+	Text string        //what was printed, for Print events
+}
+
+// Recorder collects events from many goroutines
+type Recorder struct {
+	start  time.Time
+	out    io.Writer
+	mu     sync.Mutex
+	events []Event
+	lanes  []string //in order of first appearance
+}
+
+func NewRecorder(out io.Writer) *Recorder {
+	return &Recorder{start: time.Now(), out: out}
+}
+
+func (r *Recorder) record(lane string, kind EventKind, text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(lane, kind, text)
+}
+
+// add appends an event, with mu held. The timestamp is taken under the lock too, so the events are in the order of their timestamps.
+func (r *Recorder) add(lane string, kind EventKind, text string) {
+	at := time.Since(r.start)
+	//a lane is created by its first event of any kind: Sleep and Println can be called without Go or Run
+	if !slices.Contains(r.lanes, lane) {
+		r.lanes = append(r.lanes, lane)
+	}
+	r.events = append(r.events, Event{Lane: lane, Kind: kind, At: at, Text: text})
+}
+
+// Go starts fn in a new goroutine, recording its start and end under the given name
+func (r *Recorder) Go(wg *sync.WaitGroup, lane string, fn func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.Run(lane, fn)
+	}()
+}
+
+// Run runs fn in the CURRENT goroutine, recording its start and end (for the say("hello") that main runs itself)
+func (r *Recorder) Run(lane string, fn func()) {
+	r.record(lane, Start, "")
+	defer r.record(lane, End, "")
+	fn()
+}
+
+// Sleep is time.Sleep with a sleep and a wake event around it
+func (r *Recorder) Sleep(lane string, d time.Duration) {
+	r.record(lane, Sleep, "")
+	time.Sleep(d)
+	r.record(lane, Wake, "")
+}
+
+// Println is fmt.Println with a print event. Both happen under the lock, so the lines come out in the same order as the print events.
+func (r *Recorder) Println(lane string, s string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(lane, Print, s)
+	fmt.Fprintln(r.out, s)
+}
+
+// Events returns the events sorted by time
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := append([]Event(nil), r.events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+	return events
+}
+
+// Swimlanes draws one line per goroutine. Each column covers 'step' of time, which must be more than 0.
+func (r *Recorder) Swimlanes(step time.Duration) string {
+	events := r.Events()
+	r.mu.Lock()
+	lanes := append([]string(nil), r.lanes...)
+	r.mu.Unlock()
+	if len(events) == 0 {
+		return ""
+	}
+
+	columns := int(events[len(events)-1].At/step) + 1
+	width := 0
+	for _, l := range lanes {
+		width = max(width, len(l))
+	}
+
+	//fill every lane: ' ' before start and after end, '~' while asleep, a letter where something happened
+	rows := make(map[string][]byte)
+	sleepingSince := make(map[string]int)
+	for _, l := range lanes {
+		rows[l] = []byte(strings.Repeat(" ", columns))
+	}
+	for _, e := range events {
+		col := int(e.At / step)
+		row := rows[e.Lane]
+		switch e.Kind {
+		case Start:
+			row[col] = 'S'
+		case Sleep:
+			sleepingSince[e.Lane] = col
+		case Wake:
+			for c := sleepingSince[e.Lane]; c < col; c++ {
+				if row[c] == ' ' {
+					row[c] = '~'
+				}
+			}
+		case Print:
+			row[col] = 'P'
+		case End:
+			if row[col] == ' ' {
+				row[col] = 'E'
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, l := range lanes {
+		fmt.Fprintf(&b, "%-*s |%s\n", width, l, rows[l])
+	}
+	fmt.Fprintf(&b, "%-*s  S start  ~ sleeping  P print  E end  (one column = %v)\n", width, "", step)
+	return b.String()
+}
+
+//-------CHROME TRACE EVENT FORMAT
+
+/*
+The format is a JSON object with a list of events. We use three kinds ("ph" = phase):
+	"M" metadata : gives a thread (lane) its name
+	"X" complete : something with a start (ts) and a duration (dur), drawn as a bar. We use it for sleeps.
+	"i" instant  : a single moment, drawn as a marker. We use it for prints.
+Times are in MICROSECONDS.
+*/
+
+type traceEvent struct {
+	Name  string         `json:"name"`
+	Phase string         `json:"ph"`
+	TS    float64        `json:"ts"`
+	Dur   float64        `json:"dur,omitempty"`
+	PID   int            `json:"pid"`
+	TID   int            `json:"tid"`
+	Scope string         `json:"s,omitempty"`
+	Args  map[string]any `json:"args,omitempty"`
+}
+
+func micros(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
+
+// WriteChromeTrace writes the events in Chrome's trace event JSON format
+func (r *Recorder) WriteChromeTrace(w io.Writer) error {
+	events := r.Events()
+	r.mu.Lock()
+	lanes := append([]string(nil), r.lanes...)
+	r.mu.Unlock()
+
+	tid := make(map[string]int)
+	var out []traceEvent
+	for i, l := range lanes {
+		tid[l] = i + 1
+		out = append(out, traceEvent{Name: "thread_name", Phase: "M", PID: 1, TID: i + 1, Args: map[string]any{"name": l}})
+	}
+
+	sleepStart := make(map[string]time.Duration)
+	for _, e := range events {
+		switch e.Kind {
+		case Sleep:
+			sleepStart[e.Lane] = e.At
+		case Wake:
+			start := sleepStart[e.Lane]
+			out = append(out, traceEvent{Name: "sleep", Phase: "X", TS: micros(start), Dur: micros(e.At - start), PID: 1, TID: tid[e.Lane]})
+		case Print:
+			out = append(out, traceEvent{Name: "print " + e.Text, Phase: "i", TS: micros(e.At), PID: 1, TID: tid[e.Lane], Scope: "t"})
+		default:
+			out = append(out, traceEvent{Name: string(e.Kind), Phase: "i", TS: micros(e.At), PID: 1, TID: tid[e.Lane], Scope: "t"})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(map[string]any{"traceEvents": out, "displayTimeUnit": "ms"})
+}
+
+// checkLaneWithoutStart records a lane that sleeps and prints but was never started with Go or Run. It must still get its own row.
+func checkLaneWithoutStart() {
+	rec := NewRecorder(io.Discard)
+	rec.Sleep("main", time.Millisecond)
+	rec.Println("main", "no Start event")
+	rec.Run("worker", func() {})
+	rec.Run("worker", func() {}) //a second Start must not add a second row
+
+	lines := strings.Split(strings.TrimSuffix(rec.Swimlanes(time.Millisecond), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "main ") || !strings.Contains(lines[0], "P") || !strings.HasPrefix(lines[1], "worker ") {
+		log.Fatalf("swimlanes of a lane without a Start event:\n%s", strings.Join(lines, "\n"))
+	}
+	fmt.Println("ok: a lane without a Start event gets its row, and a lane started twice gets only one")
+}
+
+//-------say() from lesson 5, instrumented
+
+func say(r *Recorder, s string) {
+	for i := 0; i < 5; i++ {
+		r.Sleep(s, 100*time.Millisecond)
+		r.Println(s, s)
+	}
+}
+
+func main() {
+	step := flag.Duration("step", 10*time.Millisecond, "time covered by one column of the swimlane")
+	jsonPath := flag.String("json", "", "also write a Chrome trace-event JSON file here")
+	flag.Parse()
+	if *step <= 0 {
+		log.Fatalf("-step must be more than 0, got %v", *step)
+	}
+
+	checkLaneWithoutStart()
+
+	rec := NewRecorder(os.Stdout)
+
+	//exactly lesson 5: "world" in a new goroutine, "hello" in main's goroutine (plus a WaitGroup, see "5 go_threads.go")
+	var wg sync.WaitGroup
+	rec.Go(&wg, "world", func() { say(rec, "world") })
+	rec.Run("hello", func() { say(rec, "hello") })
+	wg.Wait()
+
+	fmt.Println()
+	fmt.Print(rec.Swimlanes(*step))
+
+	fmt.Println("\nevents in order (microsecond precision shows who really went first):")
+	for _, e := range rec.Events() {
+		if e.Kind == Print || e.Kind == Wake {
+			fmt.Printf("  %10v  %-6s %s\n", e.At.Round(time.Microsecond), e.Lane, e.Kind)
+		}
+	}
+
+	if *jsonPath != "" {
+		f, err := os.Create(*jsonPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := rec.WriteChromeTrace(f); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("\ntrace written to", *jsonPath, "- open it in chrome://tracing or https://ui.perfetto.dev")
+	}
+}
@@ -0,0 +1,71 @@
+//RUNTIME TRACE: watching the real Go scheduler run the concurrency lessons
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime/trace"
+	"strings"
+)
+
+/*
+
+"21 scheduling_visualizer.go" records events that WE chose to record. The Go runtime can record much more: every goroutine creation, block, unblock,
+every time a goroutine is put on or taken off a CPU, garbage collection, system calls... This is the EXECUTION TRACER (package runtime/trace).
+
+This file has no main: it is added to the command line of a lesson, and gives that lesson a --trace flag.
+
+	go run "5 go_threads.go" "22 runtime_trace.go" --trace out.trace
+	go run "6 concurrency_basics.go" "22 runtime_trace.go" --trace out.trace
+	go tool trace out.trace                                                     (opens the viewer in a browser)
+
+The code of lessons 5 and 6 is annotated, so that the trace shows exactly the code you are reading:
+	-TASK   : trace.NewTask groups everything done for one logical operation, even across goroutines ("sliceSum of primes", "fibonacci")
+	-REGION : trace.WithRegion marks a stretch of time inside ONE goroutine ("partial sum", "send partial sum", "sleep", and every section of main)
+	-LOG    : trace.Log attaches a message to the task at a point in time ("quit")
+	-NAMES  : goroutines have no names in Go. Each one logs its name (category "goroutine") as the first thing it does, so its ID in the trace can be matched to a name.
+	          It also gets a pprof label "goroutine=<name>" with pprof.Do, which CPU profiles of the same code will show.
+
+In "go tool trace" look at "User-defined tasks" and "User-defined regions" for these annotations, and at "View trace" for the timeline of every goroutine.
+
+Without this file (or without --trace) the lessons run as usual: the trace calls cost almost nothing when tracing is off.
+Any other lesson can be traced the same way: add this file to its go run line, and defer trace.Stop() at the start of its main, so the end of the trace gets written out.
+
+*/
+
+// init runs before the lesson's main. It takes --trace FILE (or -trace, or --trace=FILE) out of os.Args, so the lesson's own flags are not disturbed, and starts the tracer.
+func init() {
+	path, args := "", os.Args[:1]
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "trace" {
+			args = append(args, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(os.Args) {
+				log.Fatal("--trace needs a file name")
+			}
+			i++
+			value = os.Args[i]
+		}
+		path = value
+	}
+	os.Args = args
+	if path == "" {
+		return
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := trace.Start(f); err != nil {
+		log.Fatal(err)
+	}
+	//the file is not closed: the lesson's deferred trace.Stop() writes the rest of the trace into it, and the program exits right after
+	fmt.Println("tracing to", path, "- when the lesson is done, run: go tool trace", path)
+}
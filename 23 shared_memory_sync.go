@@ -0,0 +1,332 @@
+//SHARED MEMORY: Mutex, RWMutex, atomic, sync.Once and sync.Cond
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+/*
+
+"5 go_threads.go" says "Goroutines run in the same address space, so access to shared memory must be synchronized". This lesson shows what happens when it is NOT,
+and the tools of package sync that fix it:
+	-sync.Mutex    : one goroutine at a time in the critical section
+	-sync.RWMutex  : many readers at the same time OR one writer
+	-sync/atomic   : a single variable updated in one indivisible CPU instruction, no lock at all
+	-sync.Once     : run initialization exactly once, however many goroutines ask for it
+	-sync.Cond     : sleep until some condition on shared data becomes true (here: a bounded queue that is not full / not empty)
+
+THE RACE DETECTOR finds unsynchronized access while the program runs:
+	go run -race "23 shared_memory_sync.go"             (reports "WARNING: DATA RACE" for the racy counter, and exits with status 66)
+	go run -race "23 shared_memory_sync.go" -racy=false (skips the racy counter: no report, every other section is race free)
+
+Channels are the other way to share data ("Do not communicate by sharing memory; instead, share memory by communicating"). A mutex is simpler when several goroutines
+just update one value, like the counter below.
+
+*/
+
+// Counter is what every version below implements
+type Counter interface {
+	Inc()
+	Value() int64
+}
+
+//-------THE RACE
+
+// RacyCounter has no synchronization at all
+type RacyCounter struct {
+	n int64
+}
+
+func (c *RacyCounter) Inc() {
+	//c.n++ is really three steps: read c.n, add one, write c.n back.
+	//Two goroutines can both read 5 and both write 6: one increment is LOST.
+	n := c.n
+	runtime.Gosched() //let another goroutine run between the read and the write, so the race shows up even on one CPU
+	c.n = n + 1
+}
+
+func (c *RacyCounter) Value() int64 { return c.n }
+
+//-------THE FIXES
+
+// MutexCounter: Lock/Unlock around every access
+type MutexCounter struct {
+	mu sync.Mutex
+	n  int64
+}
+
+func (c *MutexCounter) Inc() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++ //only one goroutine at a time gets here, so the three steps can no longer be interleaved
+}
+
+func (c *MutexCounter) Value() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n //reads need the lock too: without it a reader may see a half-written value
+}
+
+// AtomicCounter: the read-add-write happens as one step
+type AtomicCounter struct {
+	n atomic.Int64
+}
+
+func (c *AtomicCounter) Inc()         { c.n.Add(1) }
+func (c *AtomicCounter) Value() int64 { return c.n.Load() }
+
+// RWCounter: writers take the write lock, readers share the read lock
+type RWCounter struct {
+	mu sync.RWMutex
+	n  int64
+}
+
+func (c *RWCounter) Inc() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+}
+
+func (c *RWCounter) Value() int64 {
+	c.mu.RLock() //any number of goroutines can hold RLock together, but not while someone holds Lock
+	defer c.mu.RUnlock()
+	return c.n
+}
+
+// hammer increments c from many goroutines and returns the final value
+func hammer(c Counter, goroutines, incs int) int64 {
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < incs; i++ {
+				c.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	return c.Value()
+}
+
+//-------sync.Once
+
+// LeavePolicy is expensive to build, so it is built lazily: the first goroutine that needs it builds it, the others wait and reuse it
+type LeavePolicy struct {
+	AnnualLeaves int
+}
+
+var (
+	policyOnce  sync.Once
+	policy      *LeavePolicy
+	policyLoads atomic.Int32 //how many times the policy was really built
+)
+
+func getPolicy() *LeavePolicy {
+	policyOnce.Do(func() {
+		policyLoads.Add(1)
+		policy = &LeavePolicy{AnnualLeaves: 16} //imagine reading a file here
+	})
+	return policy //safe to read: Do returns only after the function has finished, in EVERY goroutine
+}
+
+//-------sync.Cond: a bounded queue
+
+/*
+A Cond is a place where goroutines wait for a condition on data protected by a mutex:
+	-Wait()      : unlock the mutex, sleep, and lock it again when woken up. Always call it in a FOR loop: when you wake up, the condition may be false again.
+	-Signal()    : wake one waiting goroutine
+	-Broadcast() : wake all of them
+BoundedQueue is what a buffered channel does internally: Put waits while the queue is full, Get waits while it is empty.
+*/
+
+type BoundedQueue[T any] struct {
+	mu       sync.Mutex
+	notFull  *sync.Cond
+	notEmpty *sync.Cond
+	items    []T
+	capacity int
+	closed   bool
+	maxLen   int //the most items ever queued at once, recorded by Put while it holds the lock
+}
+
+func NewBoundedQueue[T any](capacity int) *BoundedQueue[T] {
+	q := &BoundedQueue[T]{capacity: capacity}
+	q.notFull = sync.NewCond(&q.mu)
+	q.notEmpty = sync.NewCond(&q.mu) //both conds share the one mutex that protects items
+	return q
+}
+
+// Put waits for room. It returns false if the queue was closed.
+func (q *BoundedQueue[T]) Put(v T) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) >= q.capacity && !q.closed {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return false
+	}
+	q.items = append(q.items, v)
+	q.maxLen = max(q.maxLen, len(q.items))
+	q.notEmpty.Signal() //one item in: one getter can go on
+	return true
+}
+
+// Get waits for an item. ok is false once the queue is closed and empty, like receiving from a closed channel.
+func (q *BoundedQueue[T]) Get() (v T, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if len(q.items) == 0 {
+		return v, false
+	}
+	v = q.items[0]
+	q.items = q.items[1:]
+	q.notFull.Signal() //one slot free: one putter can go on
+	return v, true
+}
+
+func (q *BoundedQueue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notFull.Broadcast() //EVERYONE must wake up and see closed, not just one
+	q.notEmpty.Broadcast()
+}
+
+func (q *BoundedQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// MaxLen is the highest Len has ever been. Sampling Len from outside could miss the moments the queue was fullest.
+func (q *BoundedQueue[T]) MaxLen() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.maxLen
+}
+
+func main() {
+	racy := flag.Bool("racy", true, "run the unsynchronized counter (turn it off to check the rest of the lesson with -race)")
+	flag.Parse()
+
+	const goroutines, incs = 8, 1000
+	want := int64(goroutines * incs)
+
+	//-------THE RACE
+	if *racy {
+		got := hammer(&RacyCounter{}, goroutines, incs)
+		fmt.Printf("racy counter:   %5d of %d (%d increments lost)\n", got, want, want-got)
+	}
+
+	//-------THE FIXES
+	for _, c := range []struct {
+		name    string
+		counter Counter
+	}{
+		{"mutex counter:", &MutexCounter{}},
+		{"atomic counter:", &AtomicCounter{}},
+		{"rwmutex counter:", &RWCounter{}},
+	} {
+		got := hammer(c.counter, goroutines, incs)
+		if got != want {
+			panic(fmt.Sprintf("%s got %d, want %d", c.name, got, want))
+		}
+		fmt.Printf("%-16s%5d of %d\n", c.name, got, want)
+	}
+
+	//-------sync.Once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if getPolicy().AnnualLeaves != 16 {
+				panic("once: policy not ready")
+			}
+		}()
+	}
+	wg.Wait()
+	if policyLoads.Load() != 1 {
+		panic(fmt.Sprintf("once: policy built %d times", policyLoads.Load()))
+	}
+	fmt.Println("10 goroutines asked for the policy, it was built", policyLoads.Load(), "time")
+
+	//-------sync.Cond
+	q := NewBoundedQueue[int](3)
+	var producers sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		producers.Add(1)
+		go func() {
+			defer producers.Done()
+			for i := 1; i <= 25; i++ {
+				q.Put(i)
+			}
+		}()
+	}
+	go func() {
+		producers.Wait()
+		q.Close() //like close(ch) after the last send
+	}()
+
+	received, sum := 0, 0
+	for {
+		v, ok := q.Get()
+		if !ok {
+			break
+		}
+		received++
+		sum += v
+	}
+	maxLen := q.MaxLen()
+	if received != 100 || sum != 4*325 || maxLen < 1 || maxLen > 3 {
+		panic(fmt.Sprintf("cond queue: received=%d sum=%d maxLen=%d", received, sum, maxLen))
+	}
+	fmt.Printf("bounded queue: %d items received, sum %d, never more than %d queued\n", received, sum, maxLen)
+
+	//-------BENCHMARKS
+	/*
+		b.RunParallel runs the body on GOMAXPROCS goroutines at the same time, which is where locks start to cost something.
+		-atomic is the cheapest, but only works for one variable at a time
+		-for the read-heavy case (9 reads for every write) RWMutex lets readers run together. With one CPU there is nobody to run together with, so do not expect a difference there.
+	*/
+	fmt.Println("GOMAXPROCS:", runtime.GOMAXPROCS(0))
+	inc := func(c Counter) testing.BenchmarkResult {
+		return testing.Benchmark(func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					c.Inc()
+				}
+			})
+		})
+	}
+	readHeavy := func(c Counter) testing.BenchmarkResult {
+		return testing.Benchmark(func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if i%10 == 0 {
+						c.Inc()
+					} else {
+						c.Value()
+					}
+					i++
+				}
+			})
+		})
+	}
+	fmt.Printf("increment:  mutex %4d ns/op   atomic %4d ns/op   rwmutex %4d ns/op\n",
+		inc(&MutexCounter{}).NsPerOp(), inc(&AtomicCounter{}).NsPerOp(), inc(&RWCounter{}).NsPerOp())
+	fmt.Printf("read-heavy: mutex %4d ns/op   atomic %4d ns/op   rwmutex %4d ns/op\n",
+		readHeavy(&MutexCounter{}).NsPerOp(), readHeavy(&AtomicCounter{}).NsPerOp(), readHeavy(&RWCounter{}).NsPerOp())
+}
@@ -0,0 +1,688 @@
+//BOUNDED QUEUE AND SEMAPHORE: buffered channels with timeouts, resizing and close-and-drain
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+
+"6 concurrency_basics.go" makes one bounded queue: bufferedChan := make(chan int, 100). A plain buffered channel cannot:
+	-try a send and give up at once if the buffer is full         -> TryPut
+	-give up after a while, or when a context is cancelled      -> PutTimeout, Put(ctx), Get(ctx)
+	-change its capacity once made                              -> Resize
+	-tell a Put after close apart from a panic                  -> ErrClosed
+
+Queue[T] is still a buffered channel inside. Close works like close(ch): no more Puts, but Gets still receive what is left, and only then report ErrClosed.
+Drain takes everything that is left in one go.
+
+RESIZING replaces the channel by a bigger (or smaller) one and moves the values across, in order. Goroutines blocked on the OLD channel must not stay there,
+so every blocking operation also waits on a 'changed' channel. Resize closes it (closing a channel wakes EVERY goroutine waiting on it, a broadcast),
+they let go of the old channel and start again with the new one.
+
+Semaphore is a Queue of empty tokens: Acquire puts one in (blocks while all permits are taken), Release takes one out.
+The Limiter of "5 go_threads.go" is the same idea without timeouts or resizing.
+
+*/
+
+var (
+	ErrClosed   = errors.New("queue closed")
+	ErrFull     = errors.New("queue full")
+	ErrEmpty    = errors.New("queue empty")
+	ErrCapacity = errors.New("capacity must be at least 1 and at least the current length")
+)
+
+type Queue[T any] struct {
+	admin sync.Mutex //one Resize or Close at a time
+
+	//mu is held for READING by every Put and Get, also while they block, and for WRITING by Resize and Close when they swap the channel.
+	//So no Put can send into a channel that Resize has already emptied.
+	mu      sync.RWMutex
+	ch      chan T
+	changed chan struct{} //closed by Resize and Close, to wake goroutines blocked on ch
+	closed  bool
+}
+
+func NewQueue[T any](capacity int) *Queue[T] {
+	if capacity < 1 {
+		panic(ErrCapacity)
+	}
+	return &Queue[T]{ch: make(chan T, capacity), changed: make(chan struct{})}
+}
+
+// TryPut never blocks: ErrFull if there is no room
+func (q *Queue[T]) TryPut(v T) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrClosed
+	}
+	select {
+	case q.ch <- v:
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+// Put waits for room until ctx is done
+func (q *Queue[T]) Put(ctx context.Context, v T) error {
+	for {
+		q.mu.RLock()
+		if q.closed {
+			q.mu.RUnlock()
+			return ErrClosed
+		}
+		select {
+		case q.ch <- v:
+			q.mu.RUnlock()
+			return nil
+		case <-q.changed:
+			q.mu.RUnlock() //resized or closed: let Resize/Close take the lock, then try again
+		case <-ctx.Done():
+			q.mu.RUnlock()
+			return ctx.Err()
+		}
+	}
+}
+
+// PutTimeout waits for room at most d. It returns context.DeadlineExceeded if there was none.
+func (q *Queue[T]) PutTimeout(v T, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return q.Put(ctx, v)
+}
+
+// TryGet never blocks: ErrEmpty if there is nothing, ErrClosed if the queue is closed and nothing is left
+func (q *Queue[T]) TryGet() (T, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	select {
+	case v, ok := <-q.ch:
+		if !ok {
+			return v, ErrClosed
+		}
+		return v, nil
+	default:
+		var zero T
+		return zero, ErrEmpty
+	}
+}
+
+// Get waits for a value until ctx is done. After Close it still returns the values left, then ErrClosed.
+func (q *Queue[T]) Get(ctx context.Context) (T, error) {
+	for {
+		q.mu.RLock()
+		select {
+		case v, ok := <-q.ch:
+			q.mu.RUnlock()
+			if !ok {
+				return v, ErrClosed
+			}
+			return v, nil
+		case <-q.changed:
+			q.mu.RUnlock()
+		case <-ctx.Done():
+			q.mu.RUnlock()
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// Drain takes every value that is in the queue right now, without waiting for more
+func (q *Queue[T]) Drain() []T {
+	var out []T
+	for {
+		v, err := q.TryGet()
+		if err != nil {
+			return out
+		}
+		out = append(out, v)
+	}
+}
+
+func (q *Queue[T]) Len() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return len(q.ch)
+}
+
+func (q *Queue[T]) Cap() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return cap(q.ch)
+}
+
+// wakeAndLock wakes every goroutine blocked in Put or Get, and takes the write lock as soon as they have let go. admin must be held.
+func (q *Queue[T]) wakeAndLock() {
+	close(q.changed) //only admin holders write q.changed, so reading it here without mu is safe
+	q.mu.Lock()
+	q.changed = make(chan struct{})
+}
+
+// Resize changes the capacity. The values in the queue keep their order. It cannot shrink below the current length.
+func (q *Queue[T]) Resize(capacity int) error {
+	q.admin.Lock()
+	defer q.admin.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	q.wakeAndLock()
+	defer q.mu.Unlock()
+	if capacity < 1 || capacity < len(q.ch) {
+		return ErrCapacity
+	}
+	ch := make(chan T, capacity)
+	for len(q.ch) > 0 {
+		ch <- <-q.ch //nobody else can touch either channel: we hold the write lock
+	}
+	q.ch = ch
+	return nil
+}
+
+// Close stops Puts. Values already in the queue can still be received.
+func (q *Queue[T]) Close() error {
+	q.admin.Lock()
+	defer q.admin.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	q.wakeAndLock()
+	defer q.mu.Unlock()
+	q.closed = true
+	close(q.ch)
+	return nil
+}
+
+//-------SEMAPHORE
+
+type Semaphore struct {
+	tokens *Queue[struct{}]
+}
+
+// NewSemaphore allows n holders at the same time
+func NewSemaphore(n int) *Semaphore {
+	return &Semaphore{tokens: NewQueue[struct{}](n)}
+}
+
+func (s *Semaphore) Acquire(ctx context.Context) error { return s.tokens.Put(ctx, struct{}{}) }
+
+func (s *Semaphore) TryAcquire() bool { return s.tokens.TryPut(struct{}{}) == nil }
+
+func (s *Semaphore) AcquireTimeout(d time.Duration) error { return s.tokens.PutTimeout(struct{}{}, d) }
+
+// Release gives a permit back. Releasing more than was acquired is a bug, so it panics, like unlocking an unlocked mutex.
+func (s *Semaphore) Release() {
+	if _, err := s.tokens.TryGet(); err != nil {
+		panic("semaphore: release without acquire")
+	}
+}
+
+// Resize changes the number of permits. It cannot go below the number currently held.
+func (s *Semaphore) Resize(n int) error { return s.tokens.Resize(n) }
+
+// Close makes every Acquire fail with ErrClosed. Holders can still Release.
+func (s *Semaphore) Close() error { return s.tokens.Close() }
+
+func (s *Semaphore) Held() int { return s.tokens.Len() }
+func (s *Semaphore) Size() int { return s.tokens.Cap() }
+
+//-------PROPERTY CHECK: Queue against a sequential model
+
+/*
+A PROPERTY-BASED check runs many RANDOM sequences of operations on the real Queue and on a MODEL: the simplest code that could possibly be right
+(here a slice, a capacity and a flag). After every operation both must give the same answer. When they differ, the seed reproduces the exact sequence.
+*/
+
+type model struct {
+	items    []int
+	capacity int
+	closed   bool
+}
+
+func (m *model) tryPut(v int) error {
+	switch {
+	case m.closed:
+		return ErrClosed
+	case len(m.items) >= m.capacity:
+		return ErrFull
+	}
+	m.items = append(m.items, v)
+	return nil
+}
+
+func (m *model) tryGet() (int, error) {
+	if len(m.items) == 0 {
+		if m.closed {
+			return 0, ErrClosed
+		}
+		return 0, ErrEmpty
+	}
+	v := m.items[0]
+	m.items = m.items[1:]
+	return v, nil
+}
+
+func (m *model) resize(capacity int) error {
+	switch {
+	case m.closed:
+		return ErrClosed
+	case capacity < 1 || capacity < len(m.items):
+		return ErrCapacity
+	}
+	m.capacity = capacity
+	return nil
+}
+
+func (m *model) close() error {
+	if m.closed {
+		return ErrClosed
+	}
+	m.closed = true
+	return nil
+}
+
+func (m *model) drain() []int {
+	out := m.items
+	m.items = nil
+	return out
+}
+
+// checkSequence runs 'steps' random operations from the given seed and returns a description of the first difference
+func checkSequence(seed uint64, steps int) error {
+	r := rand.New(rand.NewPCG(seed, 0))
+	capacity := 1 + r.IntN(5)
+	q := NewQueue[int](capacity)
+	m := &model{capacity: capacity}
+
+	var history []string
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("seed %d after %s: %s", seed, strings.Join(history, ", "), fmt.Sprintf(format, args...))
+	}
+	for i := 0; i < steps; i++ {
+		switch op := r.IntN(10); {
+		case op < 4:
+			history = append(history, fmt.Sprintf("TryPut(%d)", i))
+			if got, want := q.TryPut(i), m.tryPut(i); got != want {
+				return fail("got %v, model %v", got, want)
+			}
+		case op < 8:
+			history = append(history, "TryGet")
+			gotV, got := q.TryGet()
+			wantV, want := m.tryGet()
+			if got != want || (want == nil && gotV != wantV) {
+				return fail("got %d %v, model %d %v", gotV, got, wantV, want)
+			}
+		case op == 8:
+			n := r.IntN(7)
+			history = append(history, fmt.Sprintf("Resize(%d)", n))
+			if got, want := q.Resize(n), m.resize(n); got != want {
+				return fail("got %v, model %v", got, want)
+			}
+		default:
+			if r.IntN(4) == 0 {
+				history = append(history, "Close")
+				if got, want := q.Close(), m.close(); got != want {
+					return fail("got %v, model %v", got, want)
+				}
+			} else {
+				history = append(history, "Drain")
+				if got, want := q.Drain(), m.drain(); !slices.Equal(got, want) {
+					return fail("got %v, model %v", got, want)
+				}
+			}
+		}
+		if q.Len() != len(m.items) || q.Cap() != m.capacity {
+			return fail("len/cap %d/%d, model %d/%d", q.Len(), q.Cap(), len(m.items), m.capacity)
+		}
+	}
+	return nil
+}
+
+func checkAgainstModel() {
+	const sequences, steps = 2000, 40
+	for seed := uint64(0); seed < sequences; seed++ {
+		if err := checkSequence(seed, steps); err != nil {
+			panic(err)
+		}
+	}
+	fmt.Printf("ok: %d random sequences of %d operations match the model\n", sequences, steps)
+}
+
+//-------PROPERTY CHECK: Semaphore against a counter
+
+// semModel is the simplest semaphore: how many permits are held, out of how many
+type semModel struct {
+	held, size int
+	closed     bool
+}
+
+func (m *semModel) tryAcquire() bool {
+	if m.closed || m.held >= m.size {
+		return false
+	}
+	m.held++
+	return true
+}
+
+// release reports false where Semaphore.Release panics
+func (m *semModel) release() bool {
+	if m.held == 0 {
+		return false
+	}
+	m.held--
+	return true
+}
+
+func (m *semModel) resize(n int) error {
+	switch {
+	case m.closed:
+		return ErrClosed
+	case n < 1 || n < m.held:
+		return ErrCapacity
+	}
+	m.size = n
+	return nil
+}
+
+// releaseRecovered is Release that reports a panic as false
+func releaseRecovered(s *Semaphore) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	s.Release()
+	return true
+}
+
+// checkSemaphoreSequence is checkSequence for a Semaphore
+func checkSemaphoreSequence(seed uint64, steps int) error {
+	r := rand.New(rand.NewPCG(seed, 1))
+	size := 1 + r.IntN(4)
+	s := NewSemaphore(size)
+	m := &semModel{size: size}
+
+	var history []string
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("semaphore seed %d after %s: %s", seed, strings.Join(history, ", "), fmt.Sprintf(format, args...))
+	}
+	for i := 0; i < steps; i++ {
+		switch op := r.IntN(10); {
+		case op < 3:
+			//Acquire blocks while all permits are held. When the model says so, the Acquire must really be waiting before it is cancelled,
+			//and then no permit may be handed out. Otherwise the deadline only stops a wrong Semaphore from blocking the check forever.
+			history = append(history, "Acquire")
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			result := make(chan error, 1)
+			go func() { result <- s.Acquire(ctx) }()
+			want := error(nil)
+			if !m.tryAcquire() {
+				want = ErrClosed
+				if !m.closed {
+					want = context.Canceled
+					if !waitUntilBlocked("(*Semaphore).Acquire(", result) {
+						cancel()
+						return fail("returned %v without waiting, model blocks", <-result)
+					}
+					cancel()
+				}
+			}
+			got := <-result
+			cancel()
+			if got != want {
+				return fail("got %v, model %v", got, want)
+			}
+		case op < 5:
+			history = append(history, "TryAcquire")
+			if got, want := s.TryAcquire(), m.tryAcquire(); got != want {
+				return fail("got %v, model %v", got, want)
+			}
+		case op < 8:
+			history = append(history, "Release")
+			if got, want := releaseRecovered(s), m.release(); got != want {
+				return fail("released %v, model %v", got, want)
+			}
+		case op < 9 || r.IntN(4) > 0:
+			n := r.IntN(6)
+			history = append(history, fmt.Sprintf("Resize(%d)", n))
+			if got, want := s.Resize(n), m.resize(n); got != want {
+				return fail("got %v, model %v", got, want)
+			}
+		default:
+			history = append(history, "Close")
+			want := error(nil)
+			if m.closed {
+				want = ErrClosed
+			}
+			m.closed = true
+			if got := s.Close(); got != want {
+				return fail("got %v, model %v", got, want)
+			}
+		}
+		if s.Held() != m.held || s.Size() != m.size {
+			return fail("held/size %d/%d, model %d/%d", s.Held(), s.Size(), m.held, m.size)
+		}
+	}
+	return nil
+}
+
+func checkSemaphoreAgainstModel() {
+	const sequences, steps = 2000, 40
+	for seed := uint64(0); seed < sequences; seed++ {
+		if err := checkSemaphoreSequence(seed, steps); err != nil {
+			panic(err)
+		}
+	}
+	fmt.Printf("ok: %d random sequences of %d semaphore operations match the counter\n", sequences, steps)
+}
+
+//-------CONCURRENT CHECKS (run with -race)
+
+// waitUntilBlocked waits until some goroutine is parked in a select inside fn, reading the stacks of all goroutines like "12 leak_detector.go".
+// A sleep can only HOPE the goroutine got there. If the operation returns on result instead, it never blocked: the result is put back and it returns false.
+func waitUntilBlocked(fn string, result chan error) bool {
+	buf := make([]byte, 64<<10)
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); runtime.Gosched() {
+		select {
+		case err := <-result:
+			result <- err
+			return false
+		default:
+		}
+		for _, g := range strings.Split(string(buf[:runtime.Stack(buf, true)]), "\n\n") {
+			header, _, _ := strings.Cut(g, "\n")
+			if strings.Contains(header, " [select") && strings.Contains(g, fn) {
+				return true
+			}
+		}
+	}
+	panic(fmt.Sprintf("no goroutine blocked in %s after a second", fn))
+}
+
+// checkConcurrentResize moves 1..1000 through the queue with 4 producers and 4 consumers while another goroutine keeps resizing it
+func checkConcurrentResize() {
+	q := NewQueue[int](2)
+	ctx := context.Background()
+	const producers, perProducer = 4, 250
+
+	var putters, getters sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		putters.Add(1)
+		go func() {
+			defer putters.Done()
+			for i := 1; i <= perProducer; i++ {
+				if err := q.Put(ctx, p*perProducer+i); err != nil {
+					panic(err)
+				}
+			}
+		}()
+	}
+
+	var mu sync.Mutex
+	var got []int
+	for c := 0; c < 4; c++ {
+		getters.Add(1)
+		go func() {
+			defer getters.Done()
+			for {
+				v, err := q.Get(ctx)
+				if errors.Is(err, ErrClosed) {
+					return
+				}
+				mu.Lock()
+				got = append(got, v)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	stopResizing := make(chan struct{})
+	resized := make(chan int)
+	go func() {
+		n := 0
+		for {
+			select {
+			case <-stopResizing:
+				resized <- n
+				return
+			default:
+			}
+			if q.Resize(1+n%8) == nil { //fails harmlessly when the queue holds more than the new size
+				n++
+			}
+			time.Sleep(50 * time.Microsecond)
+		}
+	}()
+
+	putters.Wait()
+	close(stopResizing)
+	resizes := <-resized
+	q.Close()
+	getters.Wait()
+
+	slices.Sort(got)
+	for i, v := range got {
+		if v != i+1 {
+			panic(fmt.Sprintf("resize: value %d missing or duplicated", i+1))
+		}
+	}
+	if len(got) != producers*perProducer {
+		panic(fmt.Sprintf("resize: got %d values", len(got)))
+	}
+	fmt.Printf("ok: %d values through the queue while it was resized %d times, none lost or duplicated\n", len(got), resizes)
+}
+
+func checkTimeouts() {
+	q := NewQueue[string](1)
+	if err := q.TryPut("first"); err != nil {
+		panic(err)
+	}
+	if err := q.TryPut("second"); !errors.Is(err, ErrFull) {
+		panic(fmt.Sprintf("TryPut on a full queue: %v", err))
+	}
+	start := time.Now()
+	if err := q.PutTimeout("second", 20*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		panic(fmt.Sprintf("PutTimeout on a full queue: %v", err))
+	}
+	fmt.Printf("ok: TryPut on a full queue -> %v, PutTimeout gave up after %v\n", ErrFull, time.Since(start).Round(10*time.Millisecond))
+
+	//a Put blocked on a full queue goes on as soon as Resize makes room
+	done := make(chan error, 1)
+	go func() { done <- q.Put(context.Background(), "second") }()
+	if !waitUntilBlocked("(*Queue[...]).Put(", done) {
+		panic(fmt.Sprintf("Put on a full queue returned %v without waiting", <-done))
+	}
+	if err := q.Resize(2); err != nil {
+		panic(err)
+	}
+	if err := <-done; err != nil {
+		panic(err)
+	}
+
+	//a Get blocked on an empty queue is woken by Close
+	left := q.Drain()
+	if !slices.Equal(left, []string{"first", "second"}) {
+		panic(fmt.Sprintf("drain: %v", left))
+	}
+	got := make(chan error, 1)
+	go func() {
+		_, err := q.Get(context.Background())
+		got <- err
+	}()
+	if !waitUntilBlocked("(*Queue[...]).Get(", got) {
+		panic(fmt.Sprintf("Get on an empty queue returned %v without waiting", <-got))
+	}
+	if err := q.Close(); err != nil {
+		panic(err)
+	}
+	select {
+	case err := <-got:
+		if !errors.Is(err, ErrClosed) {
+			panic(fmt.Sprintf("blocked Get after Close: %v", err))
+		}
+	case <-time.After(time.Second):
+		panic("Close did not wake the blocked Get")
+	}
+	fmt.Println("ok: the blocked Put went on after Resize(2); Drain returned", left, "and Close woke the blocked Get with", ErrClosed)
+}
+
+func checkSemaphore() {
+	sem := NewSemaphore(2)
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sem.Acquire(context.Background()); err != nil {
+				panic(err)
+			}
+			defer sem.Release()
+			mu.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if maxRunning > 2 {
+		panic(fmt.Sprintf("semaphore: %d holders at once", maxRunning))
+	}
+
+	sem.Acquire(context.Background())
+	sem.Acquire(context.Background())
+	if sem.TryAcquire() {
+		panic("semaphore: third TryAcquire succeeded with 2 permits")
+	}
+	if err := sem.Resize(3); err != nil || !sem.TryAcquire() {
+		panic("semaphore: resize to 3 did not add a permit")
+	}
+	if err := sem.Resize(1); !errors.Is(err, ErrCapacity) {
+		panic(fmt.Sprintf("semaphore: shrinking below the holders: %v", err))
+	}
+	fmt.Printf("ok: semaphore of 2 never had more than %d holders; after Resize(3) it holds %d of %d\n", maxRunning, sem.Held(), sem.Size())
+}
+
+func main() {
+	checkAgainstModel()
+	checkSemaphoreAgainstModel()
+	checkTimeouts()
+	checkSemaphore()
+	checkConcurrentResize()
+}
@@ -0,0 +1,359 @@
+//ACTORS: a goroutine that owns its state and is only reached through its mailbox
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+
+In "6 concurrency_basics.go" fibonacci() OWNS x and y: no other goroutine touches them, others only talk to it through channels. That is the ACTOR idea:
+	-an actor is a goroutine with PRIVATE state
+	-its MAILBOX is a channel of messages. It handles them one at a time, so its state never needs a mutex
+	-Tell(msg)       : fire and forget
+	-Ask(msg)        : send a message that carries a Future, and wait for the actor to fill it in (request/reply)
+	-SUPERVISION     : if handling a message panics, the actor is RESTARTED with fresh state instead of taking the program down.
+	                   After MaxRestarts crashes IN A ROW it gives up; one message handled without crashing resets that count.
+	-Stop(ctx)       : GRACEFUL stop: no new messages, but the ones already in the mailbox are still handled
+
+A restarted actor loses what was in its memory, so an actor that must not forget saves its state somewhere after every change and reloads it on restart.
+
+*/
+
+var (
+	ErrStopped = errors.New("actor stopped")
+	ErrCrashed = errors.New("actor crashed while handling the message")
+)
+
+//-------FUTURES: the reply half of Ask
+
+// Future is a value that an actor will provide later. It is filled in exactly once, with a value or an error.
+type Future[R any] struct {
+	once  sync.Once
+	done  chan struct{}
+	value R
+	err   error
+}
+
+func NewFuture[R any]() *Future[R] {
+	return &Future[R]{done: make(chan struct{})}
+}
+
+func (f *Future[R]) complete(v R, err error) {
+	f.once.Do(func() {
+		f.value, f.err = v, err
+		close(f.done) //wakes every Await
+	})
+}
+
+// Resolve fills the future in with a value. Only the first Resolve or Reject counts.
+func (f *Future[R]) Resolve(v R) { f.complete(v, nil) }
+
+func (f *Future[R]) Reject(err error) {
+	var zero R
+	f.complete(zero, err)
+}
+
+// Await waits for the value, or until ctx is done
+func (f *Future[R]) Await(ctx context.Context) (R, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero R
+		return zero, ctx.Err()
+	}
+}
+
+//-------THE ACTOR
+
+// Behavior handles one message. The actor's state lives in the closure, and only the actor's goroutine ever runs it.
+type Behavior[M any] func(msg M)
+
+type envelope[M any] struct {
+	msg  M
+	fail func(error) //rejects the Ask waiting for this message, if any, when the actor cannot answer it
+}
+
+type SupervisorOptions struct {
+	MaxRestarts int           //after this many restarts in a row (with no message handled in between) the actor gives up and stops
+	Backoff     time.Duration //pause before each restart
+}
+
+// Ref is the only handle other goroutines get: they can send to the actor, never touch its state
+type Ref[M any] struct {
+	name        string
+	options     SupervisorOptions
+	newBehavior func() Behavior[M]
+
+	mu       sync.RWMutex //held for reading while sending, for writing while closing the mailbox
+	mailbox  chan envelope[M]
+	stopping bool
+
+	done     chan struct{}
+	restarts int //restarts over the actor's whole life. Only written by the actor's goroutine, read after done is closed
+}
+
+// Spawn starts an actor. newBehavior is called at the start and again after every crash, to build fresh state.
+func Spawn[M any](name string, mailboxSize int, options SupervisorOptions, newBehavior func() Behavior[M]) *Ref[M] {
+	r := &Ref[M]{
+		name:        name,
+		options:     options,
+		newBehavior: newBehavior,
+		mailbox:     make(chan envelope[M], mailboxSize),
+		done:        make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *Ref[M]) run() {
+	defer close(r.done)
+	behavior := r.newBehavior()
+	gaveUp := false
+	//restarts since the last message that was handled without crashing
+	inARow := 0
+	for env := range r.mailbox { //ends once Stop has closed the mailbox and it is empty
+		if gaveUp {
+			env.fail(ErrStopped)
+			continue
+		}
+		err := handle(behavior, env.msg)
+		if err == nil {
+			inARow = 0 //the fresh state works: earlier crashes no longer count against it
+			continue
+		}
+		env.fail(err)
+		if inARow == r.options.MaxRestarts {
+			fmt.Printf("[%s] %v, gave up after %d restarts in a row\n", r.name, err, inARow)
+			gaveUp = true
+			go r.Stop(context.Background()) //refuse new messages; the ones already queued are failed above
+			continue
+		}
+		inARow++
+		r.restarts++
+		fmt.Printf("[%s] %v, restart %d of %d in a row\n", r.name, err, inARow, r.options.MaxRestarts)
+		time.Sleep(r.options.Backoff)
+		behavior = r.newBehavior()
+	}
+}
+
+// handle runs the behavior for one message. The deferred recover turns a panic into an error, like run() in "11 worker_pool.go".
+func handle[M any](behavior Behavior[M], msg M) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("%w: %v", ErrCrashed, v)
+		}
+	}()
+	behavior(msg)
+	return nil
+}
+
+func (r *Ref[M]) send(env envelope[M]) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.stopping {
+		return ErrStopped
+	}
+	r.mailbox <- env //the mailbox is only closed under the write lock, so this cannot panic
+	return nil
+}
+
+// Tell sends a message without waiting for an answer
+func (r *Ref[M]) Tell(msg M) error {
+	return r.send(envelope[M]{msg: msg, fail: func(error) {}})
+}
+
+// Ask sends the message built by makeMsg, which must carry the future to the actor, and waits for the actor to fill it in
+func Ask[M, R any](ctx context.Context, r *Ref[M], makeMsg func(reply *Future[R]) M) (R, error) {
+	reply := NewFuture[R]()
+	if err := r.send(envelope[M]{msg: makeMsg(reply), fail: reply.Reject}); err != nil {
+		var zero R
+		return zero, err
+	}
+	return reply.Await(ctx)
+}
+
+// Stop closes the mailbox and waits until the messages already in it have been handled
+func (r *Ref[M]) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.stopping {
+		r.stopping = true
+		close(r.mailbox)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Restarts counts every restart over the actor's life (not only in a row). It can be read once the actor has stopped
+func (r *Ref[M]) Restarts() int {
+	<-r.done
+	return r.restarts
+}
+
+//-------DEMO: an Employee's leave balance owned by an actor
+
+// Employee as in "3 classes_in_golang.go"
+type Employee struct {
+	FirstName   string
+	TotalLeaves int
+	LeavesTaken int
+}
+
+var ErrNotEnoughLeave = errors.New("not enough leave")
+
+// the messages a leave actor understands
+type LeaveMsg interface{ leaveMsg() }
+
+type RequestLeave struct {
+	Days  int
+	Reply *Future[int] //the remaining balance, or ErrNotEnoughLeave
+}
+
+type GetBalance struct {
+	Reply *Future[int]
+}
+
+// CancelLeave gives days back. It is sent with Tell: nobody waits for an answer.
+type CancelLeave struct {
+	Days int
+}
+
+func (RequestLeave) leaveMsg() {}
+func (GetBalance) leaveMsg()   {}
+func (CancelLeave) leaveMsg()  {}
+
+// leaveActor builds the behavior for one employee. saved stands for a database: the actor writes it after every change and reads it when it (re)starts.
+// Only the actor's goroutine touches it, and main reads it only after Stop.
+func leaveActor(saved *Employee) func() Behavior[LeaveMsg] {
+	return func() Behavior[LeaveMsg] {
+		e := *saved //fresh state: the last saved copy
+		return func(msg LeaveMsg) {
+			switch m := msg.(type) {
+			case RequestLeave:
+				if m.Days <= 0 {
+					panic(fmt.Sprintf("invalid number of days: %d", m.Days)) //a bug we did not handle properly
+				}
+				if e.LeavesTaken+m.Days > e.TotalLeaves {
+					m.Reply.Reject(fmt.Errorf("%s asked for %d days, %d left: %w", e.FirstName, m.Days, e.TotalLeaves-e.LeavesTaken, ErrNotEnoughLeave))
+					return
+				}
+				e.LeavesTaken += m.Days //no mutex: nobody else can see e
+				*saved = e
+				m.Reply.Resolve(e.TotalLeaves - e.LeavesTaken)
+			case CancelLeave:
+				e.LeavesTaken = max(0, e.LeavesTaken-m.Days)
+				*saved = e
+			case GetBalance:
+				m.Reply.Resolve(e.TotalLeaves - e.LeavesTaken)
+			}
+		}
+	}
+}
+
+func requestLeave(ctx context.Context, ref *Ref[LeaveMsg], days int) (int, error) {
+	return Ask(ctx, ref, func(reply *Future[int]) LeaveMsg { return RequestLeave{Days: days, Reply: reply} })
+}
+
+func balance(ctx context.Context, ref *Ref[LeaveMsg]) (int, error) {
+	return Ask(ctx, ref, func(reply *Future[int]) LeaveMsg { return GetBalance{Reply: reply} })
+}
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	saved := &Employee{FirstName: "Sam", TotalLeaves: 16}
+	sam := Spawn("sam", 8, SupervisorOptions{MaxRestarts: 2, Backoff: 10 * time.Millisecond}, leaveActor(saved))
+
+	//-------MANY GOROUTINES, NO MUTEX: 20 requests of 1 day at the same time, only 16 can succeed
+	var wg sync.WaitGroup
+	var mu sync.Mutex //protects the counts below, which belong to main, not to the actor
+	granted, refused := 0, 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := requestLeave(ctx, sam, 1)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				granted++
+			case errors.Is(err, ErrNotEnoughLeave):
+				refused++
+			default:
+				panic(err)
+			}
+		}()
+	}
+	wg.Wait()
+	left, _ := balance(ctx, sam)
+	if granted != 16 || refused != 4 || left != 0 {
+		panic(fmt.Sprintf("actor: granted=%d refused=%d left=%d", granted, refused, left))
+	}
+	fmt.Printf("20 concurrent requests: %d granted, %d refused, balance %d\n", granted, refused, left)
+
+	_, err := requestLeave(ctx, sam, 3)
+	fmt.Println("one more:", err)
+
+	//-------SUPERVISION: a message that panics crashes the actor, which restarts from the saved state
+	_, err = requestLeave(ctx, sam, 0)
+	fmt.Println("bad request:", err)
+	left, _ = balance(ctx, sam)
+	if left != 0 {
+		panic(fmt.Sprintf("restart: balance %d", left))
+	}
+	fmt.Println("balance after the restart:", left, "(reloaded from the saved state: a fresh Employee would have 16)")
+
+	//-------GRACEFUL STOP: messages already in the mailbox are handled, new ones are refused
+	for i := 0; i < 3; i++ {
+		sam.Tell(CancelLeave{Days: 1})
+	}
+	if err := sam.Stop(ctx); err != nil {
+		panic(err)
+	}
+	if err := sam.Tell(CancelLeave{Days: 1}); !errors.Is(err, ErrStopped) {
+		panic(fmt.Sprintf("Tell after Stop: %v", err))
+	}
+	if saved.LeavesTaken != 13 || sam.Restarts() != 1 {
+		panic(fmt.Sprintf("stop: taken=%d restarts=%d", saved.LeavesTaken, sam.Restarts()))
+	}
+	fmt.Printf("stopped after handling the 3 queued cancellations: %d of %d days taken, %d restart\n", saved.LeavesTaken, saved.TotalLeaves, sam.Restarts())
+
+	//-------GIVING UP: too many crashes in a row stop the actor for good
+	fragile := Spawn("fragile", 8, SupervisorOptions{MaxRestarts: 2}, leaveActor(&Employee{FirstName: "Ann", TotalLeaves: 16}))
+
+	//crashes with a handled message in between are not "in a row": 3 crashes, but never more than 1 in a row
+	for i := 0; i < 3; i++ {
+		requestLeave(ctx, fragile, -1)
+		if _, err := balance(ctx, fragile); err != nil {
+			panic(fmt.Sprintf("crash %d with successes in between: %v", i+1, err))
+		}
+	}
+	fmt.Println("3 crashes, each followed by a handled message: still running")
+
+	for i := 0; i < 3; i++ {
+		_, err := requestLeave(ctx, fragile, -1)
+		fmt.Println("bad request:", err)
+	}
+	fragile.Stop(ctx)
+	if _, err := balance(ctx, fragile); !errors.Is(err, ErrStopped) {
+		panic(fmt.Sprintf("after giving up: %v", err))
+	}
+	if fragile.Restarts() != 5 {
+		panic(fmt.Sprintf("fragile restarts: %d", fragile.Restarts()))
+	}
+	fmt.Println("after 2 restarts in a row the third crash stopped it:", ErrStopped, "(5 restarts in its whole life)")
+}
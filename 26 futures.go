@@ -0,0 +1,259 @@
+//FUTURES: one result per goroutine, with Then, All, Any and errors
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+
+In "6 concurrency_basics.go" both sliceSum goroutines send on the SAME sumChan:
+	first, second := <-sumChan, <-sumChan
+first is whichever sum ARRIVED first, so each goroutine has to send its number along to say which half it belongs to. And if a goroutine fails, it has no way to say so.
+
+A FUTURE is the result of ONE goroutine, delivered later:
+	-Go(ctx, fn)        : runs fn in a goroutine and returns its Future right away
+	-Await(ctx)         : waits for the value AND the error (or gives up when ctx is done)
+	-Then(f, fn)        : a new future: fn applied to f's value. If f failed, fn is skipped and the error is passed on
+	-All(fs...)         : all the values, in the order of the futures. The FIRST error fails the whole thing without waiting for the rest
+	-Any(fs...)         : the first value that succeeds. Only if every future fails, an error with all the errors
+
+Each future has its own channel, so there is nothing to mix up: sum1 is the first half, whatever finishes first.
+"25 actors.go" has a smaller Future that actors fill in by hand.
+
+*/
+
+var (
+	ErrPanicked  = errors.New("future panicked")
+	ErrNoFutures = errors.New("Any: no futures")
+)
+
+type Future[T any] struct {
+	done  chan struct{} //closed once value and err are set; closing wakes every Await
+	value T
+	err   error
+}
+
+// Go runs fn in a new goroutine. A panic in fn becomes the future's error.
+func Go[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) *Future[T] {
+	f := &Future[T]{done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		defer func() {
+			if v := recover(); v != nil {
+				f.err = fmt.Errorf("%w: %v", ErrPanicked, v)
+			}
+		}()
+		f.value, f.err = fn(ctx)
+	}()
+	return f
+}
+
+// Resolved is a future that already has its value
+func Resolved[T any](v T) *Future[T] {
+	f := &Future[T]{done: make(chan struct{}), value: v}
+	close(f.done)
+	return f
+}
+
+// Await waits for the result. It can be called any number of times, from any goroutine.
+func (f *Future[T]) Await(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Done is closed once the result is ready, for use in a select
+func (f *Future[T]) Done() <-chan struct{} { return f.done }
+
+// Then chains fn after f. It is a function, not a method, because Go methods cannot have their own type parameters (U here).
+func Then[T, U any](ctx context.Context, f *Future[T], fn func(ctx context.Context, v T) (U, error)) *Future[U] {
+	return Go(ctx, func(ctx context.Context) (U, error) {
+		v, err := f.Await(ctx)
+		if err != nil {
+			var zero U
+			return zero, err
+		}
+		return fn(ctx, v)
+	})
+}
+
+// All waits for every future and returns their values in order, or the first error that happens
+func All[T any](ctx context.Context, fs ...*Future[T]) *Future[[]T] {
+	return Go(ctx, func(ctx context.Context) ([]T, error) {
+		values := make([]T, len(fs))
+		//take the futures in the order they finish, so that an error from the last one is seen without waiting for the first one
+		ready, stop := watch(fs)
+		defer stop()
+		for range fs {
+			i, err := next(ctx, ready)
+			if err != nil {
+				return nil, err
+			}
+			v, err := fs[i].Await(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("future %d: %w", i, err)
+			}
+			values[i] = v
+		}
+		return values, nil
+	})
+}
+
+// Any returns the first value that succeeds. If every future fails, the error joins all their errors. With no futures at all it fails too.
+func Any[T any](ctx context.Context, fs ...*Future[T]) *Future[T] {
+	return Go(ctx, func(ctx context.Context) (T, error) {
+		var zero T
+		if len(fs) == 0 {
+			return zero, ErrNoFutures //there is no first success to wait for
+		}
+		errs := make([]error, 0, len(fs))
+		ready, stop := watch(fs)
+		defer stop()
+		for range fs {
+			i, err := next(ctx, ready)
+			if err != nil {
+				return zero, err
+			}
+			v, err := fs[i].Await(ctx)
+			if err == nil {
+				return v, nil
+			}
+			errs = append(errs, fmt.Errorf("future %d: %w", i, err))
+		}
+		return zero, errors.Join(errs...)
+	})
+}
+
+// watch starts ONE goroutine per future, which sends the future's index on ready once it is done.
+// The number of futures is not known when the code is written, so a select statement cannot wait on all of them: ready collects them instead.
+// Call stop when no more indexes are needed, so that the goroutines still waiting can exit.
+func watch[T any](fs []*Future[T]) (ready <-chan int, stop func()) {
+	c := make(chan int, len(fs)) //room for every index: a watcher never blocks on its send
+	done := make(chan struct{})
+	for i, f := range fs {
+		go func() {
+			select {
+			case <-f.done:
+				c <- i
+			case <-done:
+			}
+		}()
+	}
+	return c, func() { close(done) }
+}
+
+// next returns the index of the next future that is done, or the error of ctx
+func next(ctx context.Context, ready <-chan int) (int, error) {
+	select {
+	case i := <-ready:
+		return i, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+//-------sliceSum from lesson 6, as futures
+
+var errEmptySlice = errors.New("nothing to sum")
+
+func sliceSum(ctx context.Context, thisSlice []int) (int, error) {
+	if len(thisSlice) == 0 {
+		return 0, errEmptySlice
+	}
+	sum := 0
+	for _, val := range thisSlice {
+		sum += val
+	}
+	return sum, nil
+}
+
+// sumFuture is sliceSum of one part of the slice, in its own goroutine
+func sumFuture(ctx context.Context, part []int, delay time.Duration) *Future[int] {
+	return Go(ctx, func(ctx context.Context) (int, error) {
+		select {
+		case <-time.After(delay): //pretend some parts take longer, to show that the ORDER of finishing does not matter
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		return sliceSum(ctx, part)
+	})
+}
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	primes := []int{2, 3, 5, 7, 11, 13}
+
+	//-------TWO FUTURES: the second half finishes first, and still nothing is mixed up
+	sum1 := sumFuture(ctx, primes[:len(primes)/2], 30*time.Millisecond)
+	sum2 := sumFuture(ctx, primes[len(primes)/2:], 0)
+
+	partialSum1, err1 := sum1.Await(ctx)
+	partialSum2, err2 := sum2.Await(ctx)
+	if err := errors.Join(err1, err2); err != nil {
+		panic(err)
+	}
+	fmt.Println("Partial Sum1 (first half): ", partialSum1)
+	fmt.Println("Partial Sum2 (second half):", partialSum2)
+	if partialSum1 != 10 || partialSum2 != 31 {
+		panic("futures: halves mixed up")
+	}
+
+	//-------ALL and THEN: sum of the partial sums
+	total := Then(ctx, All(ctx, sum1, sum2), func(ctx context.Context, sums []int) (int, error) {
+		return sums[0] + sums[1], nil
+	})
+	t, err := total.Await(ctx)
+	fmt.Println("Total:", t, err)
+
+	//-------ERRORS: an empty part fails All, and Then never runs
+	empty := sumFuture(ctx, primes[:0], 0)
+	slow := sumFuture(ctx, primes, 200*time.Millisecond)
+	start := time.Now()
+	_, err = Then(ctx, All(ctx, slow, empty), func(ctx context.Context, sums []int) (int, error) {
+		panic("Then must not run after an error")
+	}).Await(ctx)
+	if !errors.Is(err, errEmptySlice) {
+		panic(fmt.Sprintf("all: got %v", err))
+	}
+	fmt.Printf("All failed after %v (without waiting 200ms for the slow part): %v\n", time.Since(start).Round(10*time.Millisecond), err)
+
+	//-------ANY: the first success wins; errors only if everything fails
+	fastest, err := Any(ctx, sumFuture(ctx, primes, 50*time.Millisecond), sumFuture(ctx, primes[:0], 0), sumFuture(ctx, primes, 10*time.Millisecond)).Await(ctx)
+	fmt.Println("Any:", fastest, err)
+
+	_, err = Any(ctx, sumFuture(ctx, nil, 0), Go(ctx, func(ctx context.Context) (int, error) { panic("boom") })).Await(ctx)
+	fmt.Println("Any, everything failed:", err)
+	if !errors.Is(err, errEmptySlice) || !errors.Is(err, ErrPanicked) {
+		panic(fmt.Sprintf("any: got %v", err))
+	}
+
+	_, err = Any[int](ctx).Await(ctx)
+	fmt.Println("Any of no futures:", err)
+	if !errors.Is(err, ErrNoFutures) {
+		panic(fmt.Sprintf("any of none: got %v", err))
+	}
+
+	//-------AWAIT WITH A DEADLINE: give up waiting, the future keeps its result for later
+	late := sumFuture(ctx, primes, 100*time.Millisecond)
+	short, cancelShort := context.WithTimeout(ctx, 10*time.Millisecond)
+	_, err = late.Await(short)
+	cancelShort()
+	fmt.Println("Await with a 10ms deadline:", err)
+	v, err := late.Await(ctx)
+	fmt.Println("Await again without one:", v, err)
+
+	//Resolved is handy when some values are already known
+	known, _ := All(ctx, Resolved(1), Resolved(2), sumFuture(ctx, primes, 0)).Await(ctx)
+	fmt.Println("All with resolved futures:", known)
+}
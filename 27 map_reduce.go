@@ -0,0 +1,499 @@
+//MAP-REDUCE: maps and channels together, counting the words of the lessons
+
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+/*
+
+"1 basics.go" teaches maps, "6 concurrency_basics.go" teaches channels. MAP-REDUCE uses both to split a big job over many goroutines:
+
+	inputs --> MAPPERS --(key, value)--> SHUFFLE --> REDUCERS --> output
+	           (pool)                    by hash     (pool)
+
+	-MAP      : each mapper reads one input and EMITS (key, value) pairs. Word count: ("go", 1) for every word "go".
+	-COMBINE  : optional. Each mapper first adds up its own pairs with the same key: ("go", 1) x 40 becomes ("go", 40), so much less is sent on.
+	-SHUFFLE  : every pair goes to reducer number hash(key) % reducers. So ALL the values of one key meet in the SAME reducer.
+	-REDUCE   : each reducer groups the values by key in a map[string][]V and calls Reduce(key, values) once per key.
+
+SPILLING: a reducer may receive more pairs than fit in memory. When it holds more than MaxInMemory values it sorts its map by key and writes it
+to a temp file (a SORTED RUN), then starts again with an empty map. At the end the runs (plus what is still in memory) are MERGED: since every run is
+sorted, reading them side by side (smallest key first, using a heap) brings all the values of one key together, without loading whole files.
+
+	go run "27 map_reduce.go"                          (counts the words of the lessons in this folder)
+	go run "27 map_reduce.go" -max-in-memory 100 a.txt b.txt
+
+*/
+
+type KeyValue[V any] struct {
+	Key   string
+	Value V
+}
+
+// Job says what to compute. Map and Reduce are required, Combine is optional.
+type Job[V any] struct {
+	Map     func(input string, emit func(key string, value V)) error
+	Combine func(a, b V) V //must give the same result in any order (like +), since pairs are combined in whatever order they come
+	Reduce  func(key string, values []V) V
+}
+
+type Options struct {
+	Mappers     int    //mapper goroutines, less than 1 = runtime.GOMAXPROCS(0)
+	Reducers    int    //reducer goroutines, less than 1 = runtime.GOMAXPROCS(0)
+	MaxInMemory int    //values a reducer keeps in memory before spilling to a file, 0 = no limit
+	TempDir     string //where spill files go, "" = the system's temp dir
+}
+
+// Stats counts what happened, to show what combining and spilling do
+type Stats struct {
+	Emitted  int //pairs emitted by Map
+	Shuffled int //pairs sent to reducers (fewer than Emitted when there is a Combine)
+	Spills   int //files written by reducers
+}
+
+// Run runs the job over the inputs and returns the results sorted by key
+func Run[V any](ctx context.Context, job Job[V], inputs []string, opts Options) ([]KeyValue[V], Stats, error) {
+	//with no mappers nobody would take the inputs, with no reducers partition would divide by zero
+	if opts.Mappers < 1 {
+		opts.Mappers = runtime.GOMAXPROCS(0)
+	}
+	if opts.Reducers < 1 {
+		opts.Reducers = runtime.GOMAXPROCS(0)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var (
+		statsMu sync.Mutex
+		stats   Stats
+	)
+
+	//-------reducers: one channel each, the shuffle sends batches of pairs to them
+	toReducer := make([]chan []KeyValue[V], opts.Reducers)
+	outputs := make([][]KeyValue[V], opts.Reducers)
+	var reducers sync.WaitGroup
+	for r := range toReducer {
+		toReducer[r] = make(chan []KeyValue[V], opts.Mappers)
+		reducers.Add(1)
+		go func() {
+			defer reducers.Done()
+			out, spills, err := reduce(ctx, job, toReducer[r], opts)
+			if err != nil {
+				cancel(fmt.Errorf("reducer %d: %w", r, err))
+			}
+			outputs[r] = out //each reducer writes only its own element: no lock needed
+			statsMu.Lock()
+			stats.Spills += spills
+			statsMu.Unlock()
+		}()
+	}
+
+	//-------mappers: a pool that takes inputs from a channel, like the worker pool of "11 worker_pool.go"
+	todo := make(chan string)
+	var mappers sync.WaitGroup
+	for m := 0; m < opts.Mappers; m++ {
+		mappers.Add(1)
+		go func() {
+			defer mappers.Done()
+			for input := range todo {
+				emitted, shuffled, err := mapOne(ctx, job, input, toReducer)
+				if err != nil {
+					cancel(fmt.Errorf("map %s: %w", input, err))
+					continue //keep taking inputs so the sender below is never stuck
+				}
+				statsMu.Lock()
+				stats.Emitted += emitted
+				stats.Shuffled += shuffled
+				statsMu.Unlock()
+			}
+		}()
+	}
+
+	for _, input := range inputs {
+		if ctx.Err() != nil {
+			break
+		}
+		todo <- input
+	}
+	close(todo)
+	mappers.Wait()
+	for _, ch := range toReducer {
+		close(ch) //all mappers are done: nobody sends to the reducers any more
+	}
+	reducers.Wait()
+
+	if err := context.Cause(ctx); err != nil {
+		return nil, stats, err
+	}
+	var results []KeyValue[V]
+	for _, out := range outputs {
+		results = append(results, out...)
+	}
+	slices.SortFunc(results, func(a, b KeyValue[V]) int { return strings.Compare(a.Key, b.Key) })
+	return results, stats, nil
+}
+
+// partition is the shuffle: the same key always goes to the same reducer
+func partition(key string, reducers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(reducers))
+}
+
+// mapOne maps one input, combines its pairs if the job has a Combine, and sends them to the reducers in one batch per reducer
+func mapOne[V any](ctx context.Context, job Job[V], input string, toReducer []chan []KeyValue[V]) (emitted, shuffled int, err error) {
+	batches := make([][]KeyValue[V], len(toReducer))
+	combined := make([]map[string]V, len(toReducer))
+	for r := range combined {
+		combined[r] = make(map[string]V)
+	}
+
+	err = job.Map(input, func(key string, value V) {
+		emitted++
+		r := partition(key, len(toReducer))
+		if job.Combine == nil {
+			batches[r] = append(batches[r], KeyValue[V]{key, value})
+			return
+		}
+		if old, ok := combined[r][key]; ok {
+			value = job.Combine(old, value)
+		}
+		combined[r][key] = value
+	})
+	if err != nil {
+		return emitted, 0, err
+	}
+
+	for r, ch := range toReducer {
+		for k, v := range combined[r] {
+			batches[r] = append(batches[r], KeyValue[V]{k, v})
+		}
+		if len(batches[r]) == 0 {
+			continue
+		}
+		select {
+		case ch <- batches[r]:
+			shuffled += len(batches[r])
+		case <-ctx.Done():
+			return emitted, shuffled, ctx.Err()
+		}
+	}
+	return emitted, shuffled, nil
+}
+
+//-------REDUCE SIDE: group, spill, merge
+
+// reduce collects the pairs of one reducer. It spills to a sorted run file whenever it holds more than MaxInMemory values.
+func reduce[V any](ctx context.Context, job Job[V], in <-chan []KeyValue[V], opts Options) (out []KeyValue[V], spills int, err error) {
+	groups := make(map[string][]V)
+	held := 0
+	var files []string
+	defer func() {
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}()
+
+	for batch := range in {
+		if err != nil {
+			continue //after an error, keep draining so the mappers are never stuck
+		}
+		for _, kv := range batch {
+			groups[kv.Key] = append(groups[kv.Key], kv.Value)
+			held++
+		}
+		if opts.MaxInMemory > 0 && held > opts.MaxInMemory {
+			var name string
+			name, err = spill(groups, opts.TempDir)
+			files = append(files, name)
+			clear(groups)
+			held = 0
+		}
+	}
+	if err != nil {
+		return nil, len(files), err
+	}
+
+	//merge the runs on disk with the one still in memory
+	runs := []run[V]{newMemRun(groups)}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, len(files), err
+		}
+		defer f.Close()
+		runs = append(runs, newFileRun[V](f))
+	}
+	err = merge(runs, func(key string, values []V) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		out = append(out, KeyValue[V]{key, job.Reduce(key, values)})
+		return nil
+	})
+	return out, len(files), err
+}
+
+// record is one line of a spill file: a key and all the values held for it
+type record[V any] struct {
+	Key    string `json:"k"`
+	Values []V    `json:"v"`
+}
+
+func spill[V any](groups map[string][]V, dir string) (string, error) {
+	f, err := os.CreateTemp(dir, "mapreduce-spill-*.jsonl")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, k := range slices.Sorted(maps.Keys(groups)) {
+		if err := enc.Encode(record[V]{k, groups[k]}); err != nil {
+			return f.Name(), err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return f.Name(), err
+	}
+	return f.Name(), f.Close()
+}
+
+// run is a sorted sequence of records: in memory, or read back from a spill file one line at a time
+type run[V any] interface {
+	next() (record[V], bool, error)
+}
+
+type memRun[V any] struct {
+	records []record[V]
+}
+
+func newMemRun[V any](groups map[string][]V) *memRun[V] {
+	r := &memRun[V]{}
+	for _, k := range slices.Sorted(maps.Keys(groups)) {
+		r.records = append(r.records, record[V]{k, groups[k]})
+	}
+	return r
+}
+
+func (r *memRun[V]) next() (record[V], bool, error) {
+	if len(r.records) == 0 {
+		return record[V]{}, false, nil
+	}
+	rec := r.records[0]
+	r.records = r.records[1:]
+	return rec, true, nil
+}
+
+type fileRun[V any] struct {
+	dec *json.Decoder
+}
+
+func newFileRun[V any](r io.Reader) *fileRun[V] {
+	return &fileRun[V]{dec: json.NewDecoder(bufio.NewReader(r))}
+}
+
+func (r *fileRun[V]) next() (record[V], bool, error) {
+	var rec record[V]
+	err := r.dec.Decode(&rec)
+	if errors.Is(err, io.EOF) {
+		return rec, false, nil
+	}
+	return rec, err == nil, err
+}
+
+// head is the current record of one run
+type head[V any] struct {
+	rec record[V]
+	src run[V]
+}
+
+// runHeap holds the head of every run, smallest key on top
+type runHeap[V any] []head[V]
+
+func (h runHeap[V]) Len() int           { return len(h) }
+func (h runHeap[V]) Less(i, j int) bool { return h[i].rec.Key < h[j].rec.Key }
+func (h runHeap[V]) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap[V]) Push(x any) {
+	*h = append(*h, x.(head[V]))
+}
+func (h *runHeap[V]) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// merge calls fn once per key, in key order, with the values of that key from every run
+func merge[V any](runs []run[V], fn func(key string, values []V) error) error {
+	h := &runHeap[V]{}
+	advance := func(src run[V]) error {
+		rec, ok, err := src.next()
+		if ok {
+			heap.Push(h, head[V]{rec, src})
+		}
+		return err
+	}
+	for _, r := range runs {
+		if err := advance(r); err != nil {
+			return err
+		}
+	}
+	for h.Len() > 0 {
+		key := (*h)[0].rec.Key
+		var values []V
+		for h.Len() > 0 && (*h)[0].rec.Key == key { //the same key can be on top of several runs
+			top := heap.Pop(h).(head[V])
+			values = append(values, top.rec.Values...)
+			if err := advance(top.src); err != nil {
+				return err
+			}
+		}
+		if err := fn(key, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//-------THE REFERENCE JOB: word count
+
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+}
+
+var wordCount = Job[int]{
+	Map: func(input string, emit func(string, int)) error {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			return err
+		}
+		for _, w := range words(string(data)) {
+			emit(w, 1)
+		}
+		return nil
+	},
+	Combine: func(a, b int) int { return a + b },
+	Reduce: func(key string, values []int) int {
+		sum := 0
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	},
+}
+
+// countSequentially is the same count with one plain map, to check the engine against
+func countSequentially(inputs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, input := range inputs {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range words(string(data)) {
+			counts[w]++
+		}
+	}
+	return counts, nil
+}
+
+func check(name string, results []KeyValue[int], want map[string]int) {
+	if len(results) != len(want) {
+		panic(fmt.Sprintf("%s: %d words, want %d", name, len(results), len(want)))
+	}
+	for _, kv := range results {
+		if want[kv.Key] != kv.Value {
+			panic(fmt.Sprintf("%s: %q counted %d times, want %d", name, kv.Key, kv.Value, want[kv.Key]))
+		}
+	}
+}
+
+func main() {
+	mappers := flag.Int("mappers", 4, "number of mapper goroutines")
+	reducers := flag.Int("reducers", 3, "number of reducer goroutines")
+	maxInMemory := flag.Int("max-in-memory", 500, "values a reducer holds before spilling to a temp file (0 = never spill)")
+	flag.Parse()
+	if *mappers < 1 || *reducers < 1 || *maxInMemory < 0 {
+		fmt.Println("-mappers and -reducers must be at least 1, -max-in-memory at least 0")
+		os.Exit(2)
+	}
+
+	inputs := flag.Args()
+	if len(inputs) == 0 {
+		inputs, _ = filepath.Glob("*.go") //the lessons themselves
+	}
+	if len(inputs) == 0 {
+		fmt.Println("no input files: pass some text files, or run this from the folder of the lessons")
+		os.Exit(1)
+	}
+
+	want, err := countSequentially(inputs)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		name string
+		job  Job[int]
+		opts Options
+	}{
+		{"no combiner, no limit", Job[int]{Map: wordCount.Map, Reduce: wordCount.Reduce}, Options{Mappers: *mappers, Reducers: *reducers}},
+		{"combiner", wordCount, Options{Mappers: *mappers, Reducers: *reducers}},
+		{"combiner + spilling", wordCount, Options{Mappers: *mappers, Reducers: *reducers, MaxInMemory: *maxInMemory}},
+	} {
+		results, stats, err := Run(ctx, c.job, inputs, c.opts)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		check(c.name, results, want)
+		fmt.Printf("%-22s %d files, %d distinct words | emitted %d, shuffled %d, spill files %d\n",
+			c.name+":", len(inputs), len(results), stats.Emitted, stats.Shuffled, stats.Spills)
+	}
+	fmt.Println("ok: every version matches a plain map[string]int count")
+
+	results, _, _ := Run(ctx, wordCount, inputs, Options{Mappers: *mappers, Reducers: *reducers, MaxInMemory: *maxInMemory})
+	slices.SortStableFunc(results, func(a, b KeyValue[int]) int { return b.Value - a.Value })
+	fmt.Println("most frequent words:")
+	for _, kv := range results[:min(10, len(results))] {
+		fmt.Printf("  %-12s %d\n", kv.Key, kv.Value)
+	}
+
+	//-------ZERO GOROUTINES in Options means one per CPU, instead of a division by zero (no reducers) or a deadlock (no mappers)
+	results, _, err = Run(ctx, wordCount, inputs, Options{})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	check("Options{}", results, want)
+	fmt.Println("ok: Options{} runs with", runtime.GOMAXPROCS(0), "mapper(s) and reducer(s)")
+
+	//-------ERRORS: a missing file stops the whole job
+	_, _, err = Run(ctx, wordCount, append(slices.Clone(inputs), "no such file.txt"), Options{Mappers: *mappers, Reducers: *reducers})
+	fmt.Println("with a missing input:", err)
+	if !errors.Is(err, os.ErrNotExist) {
+		panic("a missing input must fail the job")
+	}
+}
@@ -0,0 +1,713 @@
+//CALCULATOR: the arithmetic of operators() with Go's own rules, as a REPL
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/big"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+
+operators() in "1 basics.go" prints a few results for a, b := 21, 9. This lesson lets you type your own and see what Go would do:
+
+	> a, b := 21, 9
+	> a / b
+	2 (int)
+	> float64(a) / float64(b)
+	2.3333333333333335 (float64)
+	> a / 2.5
+	error: cannot use 2.5 (untyped float constant) as int value (truncated)
+
+THE RULES (the same as the Go compiler):
+	-a number without a dot is an UNTYPED INT constant, with a dot (or an exponent) an UNTYPED FLOAT constant
+	-a variable made with := gets the DEFAULT type of its value: int or float64
+	-two constants: the result is a constant too, float if either one is float. 7 / 2 is 3, 7 / 2.0 is 3.5
+	-a constant with a variable: the constant takes the variable's type, if it fits. float64 f + 1 is fine, int a + 1.5 is an error
+	-two variables must have the SAME type: int + float64 is an error. Convert explicitly with float64(a) or int(f)
+	-integer / truncates toward zero (-7 / 2 is -3), and % has the sign of the left side (-7 % 2 is -1). % is not defined on floats
+	-int(f) truncates toward zero as well. int(2.5) is an error though: 2.5 is a constant and would lose its fraction
+	-integer division by zero is an error. Float division by zero is +Inf or -Inf, unless the zero is a constant
+	-a conversion of a constant is still a constant, only a TYPED one: float64(0) is the constant 0 of type float64. Variables are never constants
+
+It is built the way real interpreters are:
+	-TOKENIZER : "a/2.5" -> [ident a] [op /] [number 2.5]
+	-PARSER    : tokens -> a TREE. A PRATT parser: every operator has a binding power, * / % bind tighter than + -
+	-EVALUATOR : walks the tree and applies the rules above
+
+	go run "28 calculator.go"                 (checks itself against real Go arithmetic, then starts the REPL; :help inside)
+	echo "7 / 2" | go run "28 calculator.go"
+
+NOTE: Go computes constants with unlimited precision, this calculator uses int64 and float64 for them, so huge constants behave differently.
+
+*/
+
+//-------TOKENIZER
+
+type TokenKind int
+
+const (
+	EOF TokenKind = iota
+	Number
+	Ident
+	Operator //+ - * / %
+	LParen
+	RParen
+	Comma
+	Assign //=
+	Define //:=
+)
+
+type Token struct {
+	Kind TokenKind
+	Text string
+	Pos  int //byte offset in the input, for error messages
+}
+
+func Tokenize(src string) ([]Token, error) {
+	var toks []Token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1]))):
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') { //exponent: 1e3, 2.5E-2
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && unicode.IsDigit(rune(src[i])) {
+					i++
+				}
+			}
+			toks = append(toks, Token{Number, src[start:i], start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_') {
+				i++
+			}
+			toks = append(toks, Token{Ident, src[start:i], start})
+		case strings.HasPrefix(src[i:], ":="):
+			toks = append(toks, Token{Define, ":=", i})
+			i += 2
+		default:
+			kind, ok := map[rune]TokenKind{'+': Operator, '-': Operator, '*': Operator, '/': Operator, '%': Operator, '(': LParen, ')': RParen, ',': Comma, '=': Assign}[c]
+			if !ok {
+				return nil, fmt.Errorf("%d: unexpected character %q", i+1, c)
+			}
+			toks = append(toks, Token{kind, string(c), i})
+			i++
+		}
+	}
+	return append(toks, Token{EOF, "", len(src)}), nil
+}
+
+//-------VALUES AND TYPES
+
+type Kind int
+
+const (
+	Int Kind = iota
+	Float
+)
+
+// Value is an int or a float64, typed (a variable or a conversion) or untyped (a constant)
+type Value struct {
+	Kind    Kind
+	Untyped bool
+	Const   bool //a constant: every untyped value, and a typed one made from constants only, like float64(0)
+	I       int64
+	F       float64
+}
+
+func (v Value) Type() string {
+	name := map[Kind]string{Int: "int", Float: "float64"}[v.Kind]
+	if v.Untyped {
+		name = map[Kind]string{Int: "untyped int", Float: "untyped float"}[v.Kind]
+	}
+	return name
+}
+
+func (v Value) String() string {
+	if v.Kind == Int {
+		return strconv.FormatInt(v.I, 10)
+	}
+	return fmt.Sprint(v.F) //the same formatting as fmt.Println(f) in the lessons
+}
+
+// describe is how Go's error messages name a value: 2.5 (untyped float constant), a (variable of type int)
+func describe(n Node, v Value) string {
+	if v.Untyped {
+		return fmt.Sprintf("%s (%s constant)", n, v.Type())
+	}
+	if _, ok := n.(Variable); ok {
+		return fmt.Sprintf("%s (variable of type %s)", n, v.Type())
+	}
+	return fmt.Sprintf("%s (value of type %s)", n, v.Type())
+}
+
+// convertConst gives the untyped constant v the type 'to', the way Go does when a constant meets a typed value
+func convertConst(n Node, v Value, to Kind) (Value, error) {
+	switch {
+	case v.Kind == to:
+	case to == Float:
+		v = Value{Kind: Float, Const: v.Const, F: float64(v.I)}
+	case v.F != math.Trunc(v.F):
+		return v, fmt.Errorf("cannot use %s as int value (truncated)", describe(n, v))
+	default:
+		v = Value{Kind: Int, Const: v.Const, I: int64(v.F)}
+	}
+	v.Untyped = false
+	return v, nil
+}
+
+//-------THE TREE
+
+type Node interface {
+	Eval(env map[string]Value) (Value, error)
+	String() string
+}
+
+type NumberLit struct{ Text string }
+
+type Variable struct{ Name string }
+
+type Unary struct {
+	Op      string
+	Operand Node
+}
+
+type Binary struct {
+	Op          string
+	Left, Right Node
+}
+
+// Conversion is int(x) or float64(x)
+type Conversion struct {
+	To  Kind
+	Arg Node
+}
+
+func (n NumberLit) String() string { return n.Text }
+func (n Variable) String() string  { return n.Name }
+func (n Unary) String() string     { return n.Op + n.Operand.String() }
+func (n Binary) String() string    { return n.Left.String() + " " + n.Op + " " + n.Right.String() }
+func (n Conversion) String() string {
+	return map[Kind]string{Int: "int", Float: "float64"}[n.To] + "(" + n.Arg.String() + ")"
+}
+
+func (n NumberLit) Eval(map[string]Value) (Value, error) {
+	if strings.ContainsAny(n.Text, ".eE") {
+		f, err := strconv.ParseFloat(n.Text, 64)
+		if err != nil {
+			return Value{}, fmt.Errorf("bad number %s", n.Text)
+		}
+		return Value{Kind: Float, Untyped: true, Const: true, F: f}, nil
+	}
+	i, err := strconv.ParseInt(n.Text, 10, 64)
+	if err != nil {
+		return Value{}, fmt.Errorf("bad number %s (more than 64 bits?)", n.Text)
+	}
+	return Value{Kind: Int, Untyped: true, Const: true, I: i, F: float64(i)}, nil
+}
+
+func (n Variable) Eval(env map[string]Value) (Value, error) {
+	v, ok := env[n.Name]
+	if !ok {
+		return Value{}, fmt.Errorf("undefined: %s", n.Name)
+	}
+	return v, nil
+}
+
+func (n Unary) Eval(env map[string]Value) (Value, error) {
+	v, err := n.Operand.Eval(env)
+	if err != nil || n.Op == "+" {
+		return v, err
+	}
+	if v.Const && v.Kind == Int && v.I == math.MinInt64 {
+		return v, fmt.Errorf("%s (constant 9223372036854775808) overflows int", n) //the smallest int has no positive twin
+	}
+	v.I, v.F = -v.I, -v.F
+	return v, nil
+}
+
+func (n Conversion) Eval(env map[string]Value) (Value, error) {
+	v, err := n.Arg.Eval(env)
+	if err != nil {
+		return v, err
+	}
+	if v.Const && n.To == Int && v.Kind == Float && v.F != math.Trunc(v.F) {
+		return v, fmt.Errorf("cannot convert %s to type int (truncated)", describe(n.Arg, v))
+	}
+	if v.Untyped {
+		return convertConst(n.Arg, v, n.To) //keeps Const: float64(0) is still a constant
+	}
+	switch {
+	case n.To == Float && v.Kind == Int:
+		return Value{Kind: Float, Const: v.Const, F: float64(v.I)}, nil
+	case n.To == Int && v.Kind == Float:
+		return Value{Kind: Int, Const: v.Const, I: int64(v.F)}, nil //truncates toward zero, like Go
+	}
+	return v, nil
+}
+
+func (n Binary) Eval(env map[string]Value) (Value, error) {
+	l, err := n.Left.Eval(env)
+	if err != nil {
+		return l, err
+	}
+	r, err := n.Right.Eval(env)
+	if err != nil {
+		return r, err
+	}
+
+	//make both sides the same type, or explain why they cannot be
+	switch {
+	case l.Untyped && r.Untyped:
+		if l.Kind != r.Kind { //untyped int with untyped float: both become untyped float
+			l.Kind, r.Kind = Float, Float
+		}
+	case r.Untyped:
+		if r, err = convertConst(n.Right, r, l.Kind); err != nil {
+			return r, err
+		}
+	case l.Untyped:
+		if l, err = convertConst(n.Left, l, r.Kind); err != nil {
+			return l, err
+		}
+	case l.Kind != r.Kind:
+		return l, fmt.Errorf("invalid operation: %s (mismatched types %s and %s)", n, l.Type(), r.Type())
+	}
+
+	result := Value{Kind: l.Kind, Untyped: l.Untyped && r.Untyped, Const: l.Const && r.Const}
+	if l.Kind == Int {
+		if (n.Op == "/" || n.Op == "%") && r.I == 0 {
+			if r.Const {
+				return result, fmt.Errorf("invalid operation: %s (division by zero)", n) //the compiler's error
+			}
+			return result, fmt.Errorf("invalid operation: %s (integer divide by zero)", n) //what Go panics with at run time
+		}
+		if result.Const {
+			//int64 arithmetic wraps around silently. That is right for variables, but Go refuses a CONSTANT that does not fit
+			if exact := exactInt(n.Op, l.I, r.I); !exact.IsInt64() {
+				return result, fmt.Errorf("%s (%s constant %s) overflows int", n, map[bool]string{true: "untyped int", false: "int"}[result.Untyped], exact)
+			}
+		}
+		switch n.Op {
+		case "+":
+			result.I = l.I + r.I
+		case "-":
+			result.I = l.I - r.I
+		case "*":
+			result.I = l.I * r.I
+		case "/", "%":
+			if n.Op == "/" {
+				result.I = l.I / r.I //truncated: Go's / on integers throws the fraction away
+			} else {
+				result.I = l.I % r.I
+			}
+		}
+		result.F = float64(result.I)
+		return result, nil
+	}
+
+	switch n.Op {
+	case "+":
+		result.F = l.F + r.F
+	case "-":
+		result.F = l.F - r.F
+	case "*":
+		result.F = l.F * r.F
+	case "/":
+		if r.F == 0 && r.Const { //Go refuses to divide by a CONSTANT zero, typed (float64(0)) or not
+			return result, fmt.Errorf("invalid operation: %s (division by zero)", n)
+		}
+		result.F = l.F / r.F //a typed zero gives +Inf, -Inf or NaN, like Go at run time
+	case "%":
+		return result, fmt.Errorf("invalid operation: operator %% not defined on %s", describe(n.Left, l))
+	}
+	if result.Const && math.IsInf(result.F, 0) {
+		return result, fmt.Errorf("%s (constant) overflows float64", n)
+	}
+	return result, nil
+}
+
+// exactInt is l op r without wrapping around, to see whether a constant result fits in an int
+func exactInt(op string, l, r int64) *big.Int {
+	a, b := big.NewInt(l), big.NewInt(r)
+	switch op {
+	case "+":
+		return a.Add(a, b)
+	case "-":
+		return a.Sub(a, b)
+	case "*":
+		return a.Mul(a, b)
+	case "/":
+		return a.Quo(a, b) //Quo truncates toward zero like Go. The only / that overflows is the smallest int divided by -1
+	}
+	return a.Rem(a, b)
+}
+
+//-------PRATT PARSER
+
+/*
+A Pratt parser reads an expression with ONE loop: parse something on the left, then, as long as the next operator binds at least as tightly as
+the caller allows (its binding power), use it to extend the left side. * / % have power 20, + - have 10:
+	1 + 2 * 3   ->  1 + (2 * 3)    because when + looks for its right side, * (20) is stronger than + (10), so 2 * 3 is parsed first
+	8 - 3 - 2   ->  (8 - 3) - 2    because the right side of - only accepts operators STRONGER than - (left associative)
+*/
+
+var bindingPower = map[string]int{"+": 10, "-": 10, "*": 20, "/": 20, "%": 20}
+
+const unaryPower = 30 //-a * b is (-a) * b
+
+type parser struct {
+	toks []Token
+	pos  int
+}
+
+func (p *parser) peek() Token { return p.toks[p.pos] }
+
+func (p *parser) next() Token {
+	t := p.toks[p.pos]
+	if t.Kind != EOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind TokenKind, what string) error {
+	if t := p.next(); t.Kind != kind {
+		return p.errorAt(t, "expected "+what)
+	}
+	return nil
+}
+
+func (p *parser) errorAt(t Token, msg string) error {
+	found := t.Text
+	if t.Kind == EOF {
+		found = "end of line"
+	}
+	return fmt.Errorf("%d: %s, found %s", t.Pos+1, msg, found)
+}
+
+// expr parses an expression whose operators all bind more tightly than minPower
+func (p *parser) expr(minPower int) (Node, error) {
+	left, err := p.prefix()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		power, ok := bindingPower[op.Text]
+		if op.Kind != Operator || !ok || power <= minPower {
+			return left, nil
+		}
+		p.next()
+		right, err := p.expr(power)
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: op.Text, Left: left, Right: right}
+	}
+}
+
+// prefix parses what can START an expression: a number, a variable, a conversion, a sign, or parentheses
+func (p *parser) prefix() (Node, error) {
+	t := p.next()
+	switch {
+	case t.Kind == Number:
+		return NumberLit{t.Text}, nil
+	case t.Kind == Ident && p.peek().Kind == LParen:
+		to, ok := map[string]Kind{"int": Int, "float64": Float}[t.Text]
+		if !ok {
+			return nil, p.errorAt(t, "only int(...) and float64(...) can be called")
+		}
+		p.next()
+		arg, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		return Conversion{To: to, Arg: arg}, p.expect(RParen, ")")
+	case t.Kind == Ident:
+		return Variable{t.Text}, nil
+	case t.Kind == Operator && (t.Text == "-" || t.Text == "+"):
+		operand, err := p.expr(unaryPower)
+		if err != nil {
+			return nil, err
+		}
+		return Unary{Op: t.Text, Operand: operand}, nil
+	case t.Kind == LParen:
+		inner, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(RParen, ")") //no node for parentheses: the tree already has the right shape
+	}
+	return nil, p.errorAt(t, "expected a number, a variable or (")
+}
+
+//-------STATEMENTS: an expression, or an assignment
+
+// Statement is either an expression to print, or names = values / names := values
+type Statement struct {
+	Names  []string
+	Define bool
+	Values []Node
+}
+
+func Parse(src string) (Statement, error) {
+	toks, err := Tokenize(src)
+	if err != nil {
+		return Statement{}, err
+	}
+	p := &parser{toks: toks}
+	var s Statement
+
+	//an assignment starts with: name {, name} (= or :=)
+	i := 0
+	for i+1 < len(toks) && toks[i].Kind == Ident && (toks[i+1].Kind == Comma || toks[i+1].Kind == Assign || toks[i+1].Kind == Define) {
+		s.Names = append(s.Names, toks[i].Text)
+		if toks[i+1].Kind != Comma {
+			s.Define = toks[i+1].Kind == Define
+			p.pos = i + 2
+			break
+		}
+		i += 2
+	}
+	if p.pos == 0 {
+		s.Names = nil //not an assignment after all, e.g. "a, b" on its own
+	}
+
+	for {
+		n, err := p.expr(0)
+		if err != nil {
+			return s, err
+		}
+		s.Values = append(s.Values, n)
+		if p.peek().Kind != Comma {
+			break
+		}
+		p.next()
+	}
+	if t := p.peek(); t.Kind != EOF {
+		return s, p.errorAt(t, "expected an operator")
+	}
+	if s.Names != nil && len(s.Names) != len(s.Values) {
+		return s, fmt.Errorf("assignment mismatch: %d variables but %d values", len(s.Names), len(s.Values))
+	}
+	if s.Names == nil && len(s.Values) > 1 {
+		return s, errors.New("one expression at a time")
+	}
+	return s, nil
+}
+
+// Exec runs a statement. It returns the value of an expression, or nothing for an assignment.
+func Exec(s Statement, env map[string]Value) (*Value, error) {
+	values := make([]Value, len(s.Values))
+	for i, n := range s.Values {
+		v, err := n.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	if s.Names == nil {
+		return &values[0], nil
+	}
+
+	if s.Define && !slices.ContainsFunc(s.Names, func(name string) bool { _, ok := env[name]; return !ok }) {
+		return nil, errors.New("no new variables on left side of :=")
+	}
+	//check everything first: a failed assignment changes nothing
+	for i, name := range s.Names {
+		v := values[i]
+		old, exists := env[name]
+		if !exists && !s.Define {
+			return nil, fmt.Errorf("undefined: %s", name)
+		}
+		if !exists { //:= gives a constant its default type
+			v.Untyped = false
+		} else if v.Untyped {
+			var err error
+			if v, err = convertConst(s.Values[i], v, old.Kind); err != nil {
+				return nil, err
+			}
+		} else if v.Kind != old.Kind {
+			return nil, fmt.Errorf("cannot use %s as %s value in assignment", describe(s.Values[i], v), old.Type())
+		}
+		v.Const = false //a variable is never a constant, whatever was assigned to it
+		values[i] = v
+	}
+	for i, name := range s.Names {
+		env[name] = values[i]
+	}
+	return nil, nil
+}
+
+//-------CHECKS: the calculator against Go itself
+
+func checkAgainstGo() {
+	env := make(map[string]Value)
+	a, b := 21, 9 //the same variables as operators()
+	f := 2.5
+	for _, setup := range []string{"a, b := 21, 9", "f := 2.5", "z := 0", "fz := 0.0", "mx := 9223372036854775807"} {
+		s, err := Parse(setup)
+		if err == nil {
+			_, err = Exec(s, env)
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+	z, fz := 0, 0.0
+	mx := math.MaxInt64
+
+	cases := []struct {
+		expr string
+		want any //int, float64, or an error message to look for
+	}{
+		//operators() from "1 basics.go"
+		{"a + b", a + b},
+		{"a - b", a - b},
+		{"a / b", a / b},
+		{"float64(a) / float64(b)", float64(a) / float64(b)},
+		{"a * b", a * b},
+		{"a % b", a % b},
+		//truncation and signs
+		{"-a / 4", -a / 4},
+		{"-a % 4", -a % 4},
+		{"a % -4", a % -4},
+		{"int(-f)", int(-f)},
+		{"int(f * 3)", int(f * 3)},
+		//precedence and parentheses
+		{"1 + 2 * 3", 1 + 2*3},
+		{"(1 + 2) * 3", (1 + 2) * 3},
+		{"a - b - 2", a - b - 2},
+		{"-a * -b", -a * -b},
+		//constants adapt to the other side
+		{"7 / 2", 7 / 2},
+		{"7 / 2.0", 7 / 2.0},
+		{"f + 1", f + 1},
+		{"f * 2 / 4", f * 2 / 4},
+		{"a + 2.0", a + 2.0},
+		{"1e3 / a", 1e3 / a},
+		{"float64(a) / 2", float64(a) / 2},
+		{"fz / f", fz / f},
+		{"f / fz", f / fz},
+		//compile errors in Go, errors here
+		{"a / 2.5", "truncated"},
+		{"a + f", "mismatched types int and float64"},
+		{"f % 2", "not defined"},
+		{"a / 0", "invalid operation: a / 0 (division by zero)"},
+		{"1 / 0", "invalid operation: 1 / 0 (division by zero)"},
+		{"a % int(0)", "(division by zero)"},
+		{"a / z", "integer divide by zero"},
+		{"9223372036854775807 + 1", "overflows int"},
+		{"int(9223372036854775807) * 2", "overflows int"},
+		{"-9223372036854775807 - 2", "overflows int"},
+		{"-(-9223372036854775807 - 1)", "overflows int"},
+		{"1e308 * 10", "overflows float64"},
+		{"mx + 1", mx + 1}, //a variable wraps around at run time, like in Go
+		{"f / 0", "division by zero"},
+		{"f / float64(0)", "division by zero"},
+		{"f / -float64(0)", "division by zero"},
+		{"float64(a) / float64(z)", float64(a) / float64(z)},
+		{"int(float64(2.5))", "truncated"},
+		{"float64(1) / float64(4)", float64(1) / float64(4)},
+		{"int(2.5)", "truncated"},
+		{"c + 1", "undefined: c"},
+		{"1 +", "expected a number"},
+		{"(1 + 2", "expected )"},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.expr)
+		var got *Value
+		if err == nil {
+			got, err = Exec(s, env)
+		}
+		switch want := c.want.(type) {
+		case string:
+			if err == nil || !strings.Contains(err.Error(), want) {
+				panic(fmt.Sprintf("%s: got %v, want an error with %q", c.expr, err, want))
+			}
+		case int:
+			if err != nil || got.Kind != Int || got.I != int64(want) {
+				panic(fmt.Sprintf("%s: got %v %v, want %d", c.expr, got, err, want))
+			}
+		case float64:
+			if err != nil || got.Kind != Float || got.F != want {
+				panic(fmt.Sprintf("%s: got %v %v, want %v", c.expr, got, err, want))
+			}
+		}
+	}
+	fmt.Printf("ok: %d expressions give the same result (or the same error) as Go\n", len(cases))
+}
+
+//-------REPL
+
+const help = `type an expression (a / b), or assign variables (a, b := 21, 9 or a = 30)
+  :vars   show the variables and their types
+  :help   this text
+  :quit   leave (or Ctrl-D)`
+
+func repl() {
+	env := make(map[string]Value)
+	in := bufio.NewScanner(os.Stdin)
+	fmt.Println(help)
+	for {
+		fmt.Print("> ")
+		if !in.Scan() {
+			fmt.Println()
+			return
+		}
+		line := strings.TrimSpace(in.Text())
+		switch line {
+		case "":
+			continue
+		case ":quit", ":q":
+			return
+		case ":help":
+			fmt.Println(help)
+			continue
+		case ":vars":
+			for _, name := range slices.Sorted(maps.Keys(env)) {
+				fmt.Printf("  %s = %v (%s)\n", name, env[name], env[name].Type())
+			}
+			continue
+		}
+
+		s, err := Parse(line)
+		var v *Value
+		if err == nil {
+			v, err = Exec(s, env)
+		}
+		switch {
+		case err != nil:
+			fmt.Println("error:", err)
+		case v != nil && v.Untyped:
+			fmt.Printf("%v (%s constant)\n", v, v.Type())
+		case v != nil:
+			fmt.Printf("%v (%s)\n", v, v.Type())
+		}
+	}
+}
+
+func main() {
+	checkAgainstGo()
+	repl()
+}
@@ -1,12 +1,20 @@
 package main
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // Go does not provide classes but it does provide structs. Methods can be added on structs. This provides the behaviour of bundling the data and methods that operate on the data together akin to a class.
 
+// Person holds what every kind of worker has in common. It is EMBEDDED (see the EMBEDDING section below) in Employee, Contractor and Intern.
+type Person struct {
+	FirstName string
+	LastName  string
+}
+
 type Employee struct {
-	FirstName   string
-	LastName    string
+	Person      //embedded field: no field name, only a type
 	TotalLeaves int
 	LeavesTaken int
 }
@@ -54,8 +62,7 @@ func (e *Employee) UpdateLeavesTaken() {
 func main() {
 
 	e := Employee{
-		FirstName:   "Sam",
-		LastName:    "Adolf",
+		Person:      Person{FirstName: "Sam", LastName: "Adolf"}, //an embedded field is initialized using its type name
 		TotalLeaves: 30,
 		LeavesTaken: 20,
 	}
@@ -71,6 +78,7 @@ func main() {
 
 	e.UpdateLeavesTaken() //the structure 'e' itself is getting updated. This will not be possible using a value receiver method because in that method, a copy of structure is shared with the method.
 
+	embeddingAndInterfaces(e)
 }
 
 // There are two reasons to use a pointer receiver.
@@ -78,3 +86,197 @@ func main() {
 // The first is so that the method can modify the value that its receiver points to.
 
 // The second is to avoid copying the value on each method call. This can be more efficient if the receiver is a large struct, for example.
+
+//-------------EMBEDDING
+
+/*
+Go has no inheritance. Instead a struct can EMBED another type: the embedded type is written without a field name.
+-The fields and methods of the embedded type are PROMOTED: e.FirstName works even though FirstName is really e.Person.FirstName
+-This is composition, not inheritance. An Employee is not a Person as far as the type system goes (you cannot pass an Employee where a Person is expected); it HAS a Person.
+*/
+
+// FullName has a value receiver, so it is in the method set of both Person and *Person (and is promoted to everything that embeds Person)
+func (p Person) FullName() string {
+	return p.FirstName + " " + p.LastName
+}
+
+// Contractor is paid per day, so leave is unpaid and unlimited: only the days off are counted
+type Contractor struct {
+	Person
+	Agency     string
+	UnpaidDays int
+}
+
+// Intern gets a fixed number of leaves for the whole internship
+type Intern struct {
+	Person
+	University string
+	DaysOff    int
+}
+
+const internLeaves = 5
+
+//-------------INTERFACES
+
+/*
+-An interface type is a set of method signatures.
+-A type satisfies (implements) an interface simply by having all of its methods. There is no 'implements' keyword.
+-A value of interface type can hold any value that satisfies it, and calling a method calls the implementation of whatever is stored inside.
+This is how Go gets polymorphism without classes.
+*/
+
+type LeaveHolder interface {
+	FullName() string
+	LeaveBalance() int //-1 means "no limit"
+	TakeLeave(days int) error
+}
+
+var errNoLeavesLeft = errors.New("no leaves left")
+
+func (e Employee) LeaveBalance() int {
+	return e.TotalLeaves - e.LeavesTaken
+}
+
+func (e *Employee) TakeLeave(days int) error {
+	if days > e.LeaveBalance() {
+		return fmt.Errorf("%s asked for %d days: %w", e.FullName(), days, errNoLeavesLeft)
+	}
+	e.LeavesTaken += days
+	return nil
+}
+
+func (c Contractor) LeaveBalance() int {
+	return -1
+}
+
+func (c *Contractor) TakeLeave(days int) error {
+	c.UnpaidDays += days //never refused, but never paid either
+	return nil
+}
+
+func (i Intern) LeaveBalance() int {
+	return internLeaves - i.DaysOff
+}
+
+func (i *Intern) TakeLeave(days int) error {
+	if days > i.LeaveBalance() {
+		return fmt.Errorf("%s asked for %d days: %w", i.FullName(), days, errNoLeavesLeft)
+	}
+	i.DaysOff += days
+	return nil
+}
+
+/*
+METHOD SETS (this is where the difference between value and pointer receivers shows up again):
+-The method set of a type T contains only the methods declared with a VALUE receiver (t T)
+-The method set of *T contains the methods declared with a value receiver AND those declared with a POINTER receiver (t *T)
+
+TakeLeave has a pointer receiver, so only *Employee, *Contractor and *Intern satisfy LeaveHolder. Employee (the value) does not.
+The compiler checks this for us. The lines below are a common trick to make the check explicit: they cost nothing at run time.
+*/
+
+var (
+	_ LeaveHolder = (*Employee)(nil)
+	_ LeaveHolder = (*Contractor)(nil)
+	_ LeaveHolder = (*Intern)(nil)
+	// _ LeaveHolder = Employee{} //uncomment: "Employee does not implement LeaveHolder (method TakeLeave has pointer receiver)"
+)
+
+// Why the rule? If a value stored in an interface could run a pointer method, the method would modify a COPY held inside the interface, and the change would be silently lost. Go refuses to compile that instead.
+
+// describe uses a TYPE SWITCH: a switch on the dynamic (real) type of the value stored in an interface
+func describe(h LeaveHolder) string {
+	switch w := h.(type) { //w has the concrete type inside each case
+	case *Employee:
+		return fmt.Sprintf("employee %s, %d of %d leaves left", w.FullName(), w.LeaveBalance(), w.TotalLeaves)
+	case *Contractor:
+		return fmt.Sprintf("contractor %s from %s, %d unpaid days so far", w.FullName(), w.Agency, w.UnpaidDays)
+	case *Intern:
+		return fmt.Sprintf("intern %s from %s, %d leaves left", w.FullName(), w.University, w.LeaveBalance())
+	default:
+		return "someone we do not know about: " + h.FullName()
+	}
+}
+
+func embeddingAndInterfaces(e Employee) {
+	fmt.Println("-------------EMBEDDING AND INTERFACES")
+
+	//promoted field and promoted method
+	fmt.Println(e.FirstName, "==", e.Person.FirstName)
+	fmt.Println("FullName promoted from Person:", e.FullName())
+
+	staff := []LeaveHolder{
+		&e, //&e and not e: only the pointer satisfies LeaveHolder
+		&Contractor{Person: Person{"Ali", "Khan"}, Agency: "TechStaff"},
+		&Intern{Person: Person{"Sara", "Ahmed"}, University: "LUMS"},
+	}
+
+	//the same call does something different depending on what is inside the interface: polymorphism
+	for _, h := range staff {
+		if err := h.TakeLeave(4); err != nil {
+			fmt.Println("Refused:", err)
+		}
+		fmt.Println(describe(h))
+	}
+
+	//a second request is too much for the intern. errors.Is looks inside the %w wrapped error
+	if err := staff[2].TakeLeave(4); errors.Is(err, errNoLeavesLeft) {
+		fmt.Println("Refused:", err)
+	}
+
+	//A TYPE ASSERTION pulls one concrete type out of an interface. With the ', ok' form it does not panic when the type is wrong.
+	if c, ok := staff[1].(*Contractor); ok {
+		fmt.Println(c.FullName(), "works for", c.Agency)
+	}
+	if _, ok := staff[1].(*Intern); !ok {
+		fmt.Println("staff[1] is not an intern")
+	}
+
+	//METHOD SETS in action: a value method can be called through a pointer, and Go automatically takes the address (&e) for a pointer method on an ADDRESSABLE variable.
+	//That convenience only works for calls on variables. It does NOT change which interfaces the value type satisfies (see the commented out line above).
+	p := &e
+	fmt.Println("value method via pointer:", p.LeaveBalance())
+	before := e.LeaveBalance()
+	if err := e.TakeLeave(1); err != nil { //same as (&e).TakeLeave(1)
+		panic(err)
+	}
+	if e.LeaveBalance() != before-1 {
+		panic(fmt.Sprintf("e.TakeLeave(1) did not change e: balance %d, was %d", e.LeaveBalance(), before))
+	}
+	fmt.Println("after e.TakeLeave(1):", e.LeaveBalance())
+
+	checkMethodSets()
+}
+
+// checkMethodSets shows the method set rules at RUN TIME: the ', ok' type assertion asks whether what is inside an interface satisfies LeaveHolder
+func checkMethodSets() {
+	for _, c := range []struct {
+		name  string
+		value any
+		want  bool
+	}{
+		{"Employee{}", Employee{}, false}, //value: TakeLeave (pointer receiver) is not in its method set
+		{"&Employee{}", &Employee{}, true},
+		{"Contractor{}", Contractor{}, false},
+		{"&Contractor{}", &Contractor{}, true},
+		{"Intern{}", Intern{}, false},
+		{"&Intern{}", &Intern{}, true},
+		{"Person{}", Person{}, false}, //has FullName only
+	} {
+		_, ok := c.value.(LeaveHolder)
+		if ok != c.want {
+			panic(fmt.Sprintf("%s is a LeaveHolder: %v, want %v", c.name, ok, c.want))
+		}
+		fmt.Printf("%-14s is a LeaveHolder: %v\n", c.name, ok)
+	}
+
+	//FullName has a value receiver, so it is in the method set of BOTH Person and *Person
+	type fullNamer interface{ FullName() string }
+	if _, ok := any(Person{}).(fullNamer); !ok {
+		panic("Person{} must have FullName")
+	}
+	if _, ok := any(&Person{}).(fullNamer); !ok {
+		panic("&Person{} must have FullName")
+	}
+	fmt.Println("ok: value types have only value-receiver methods, pointers have both")
+}
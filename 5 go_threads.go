@@ -3,45 +3,291 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"sync"
 	"time"
 )
 
-func say(s string) {
+//ctx only carries the trace annotations (see TRACING below): every sleep and print shows up as a REGION in go tool trace
+func say(ctx context.Context, s string) {
+	trace.Log(ctx, "goroutine", "say "+s) //goroutines have no names: log one, so this goroutine can be found in the trace
 	for i := 0; i < 5; i++ {
-		time.Sleep(100 * time.Millisecond) //sleep makes the go routine in which this loop is running stop execution for a while. This means that some other go routine (if present) can run.
+		trace.WithRegion(ctx, "sleep", func() {
+			time.Sleep(100 * time.Millisecond) //sleep makes the go routine in which this loop is running stop execution for a while. This means that some other go routine (if present) can run.
+		})
 
-		fmt.Println(s)
+		trace.WithRegion(ctx, "print", func() {
+			fmt.Println(s)
+		})
 	}
 }
 
+/*
+TRACING: go run "5 go_threads.go" "22 runtime_trace.go" --trace out.trace, then go tool trace out.trace
+	-a TASK groups everything done for hello/world, in both goroutines
+	-REGIONS mark the sleeps and prints in say(), and each section of the lesson
+	-the "world" goroutine gets a pprof LABEL with its name, and say() logs its name in the trace
+Without --trace all of this costs almost nothing. trace.Stop() at the end of main writes out what is left of the trace (it does nothing when tracing is off).
+*/
+
 func main() {
+	defer trace.Stop()
+	ctx, task := trace.NewTask(context.Background(), "say hello world")
 
 	// A goroutine is a lightweight  thread of execution.
 
-	//Goroutines run in the same address space, so access to shared memory must be synchronized.
+	//Goroutines run in the same address space, so access to shared memory must be synchronized. See "23 shared_memory_sync.go" for the tools that do it: Mutex, RWMutex, atomic, Once, Cond.
 
 	//The goroutines’ output may be INTERLEAVED, because goroutines are being run concurrently by the Go runtime.
 
 	//Result on console will be most probably different for each execution.
+
+	//A sync.WaitGroup waits for a collection of goroutines to finish:
+	//	-Add(n) before starting n goroutines
+	//	-each goroutine calls Done() when it finishes (use defer so it happens even on an early return)
+	//	-Wait() blocks until the counter is back to zero
+	var wg sync.WaitGroup
+	wg.Add(1)
+
 	//run the function in another go routine.
-	go say("world")
+	go func() {
+		defer wg.Done()
+		pprof.Do(ctx, pprof.Labels("goroutine", "say world"), func(ctx context.Context) {
+			say(ctx, "world")
+		})
+	}()
 	//run the function in current go routine (main go rountine)
-	say("hello")
+	say(ctx, "hello")
+
+	//Without this, main would only finish after "world" by luck: both say() take about as long, and if main returns first the last "world" is never printed.
+	wg.Wait()
 
 	//MORE: https://www.geeksforgeeks.org/goroutines-concurrency-in-golang/
 	//https://medium.com/technofunnel/understanding-golang-and-goroutines-72ac3c9a014d
 
+	task.End()
+
+	//-------the other sections of this lesson, each one a region of main's goroutine in the trace
+	bg := context.Background()
+	trace.WithRegion(bg, "counting", main2)
+	trace.WithRegion(bg, "errgroup", errGroupDemo)
+	trace.WithRegion(bg, "bounded concurrency", limiterDemo)
 }
 
-//rename this function as 'main' function and run (change the above function to main2 also)
+//main2 is called from main above, after the hello/world example
 func main2() {
 
 	//counting to 10 concurrently
+	//NOTE: If nothing waits for them, nothing prints out. This is because if the main go routine exits, all the go routines that started off within it also exit and hence do not execute. What we want is that the main go routine should wait for all other go routines to finish executing, before it exits itself.
+	//An earlier version of this lesson used time.Sleep(100 * time.Millisecond) to wait. That is a GUESS: on a busy machine 100ms may not be enough, and on a fast one it is time wasted. A WaitGroup waits exactly as long as needed.
+	var wg sync.WaitGroup
+	var mu sync.Mutex //protects 'printed', which all the goroutines append to (shared memory must be synchronized)
+	var printed []int
+
 	for i := 0; i < 11; i++ {
-		go fmt.Println(i)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fmt.Println(i)
+
+			mu.Lock()
+			printed = append(printed, i)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	//CHECK: every number was printed, whatever order the goroutines ran in
+	sort.Ints(printed)
+	for want := 0; want < 11; want++ {
+		if want >= len(printed) || printed[want] != want {
+			panic(fmt.Sprintf("counting: got %v", printed))
+		}
+	}
+	fmt.Println("all 11 numbers arrived, no sleep needed")
+}
+
+//-------ERRGROUP: a WaitGroup that also collects the first error
+
+/*
+golang.org/x/sync/errgroup is the usual package for this. Group below is a small version of it using only the standard library:
+	-Go(f) runs f in a goroutine
+	-Wait() waits for all of them and returns the FIRST error (nil if all succeeded)
+	-the first error also CANCELS the group's context, so the other goroutines can stop early instead of doing useless work
+*/
+
+type Group struct {
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc
+	errOnce sync.Once
+	err     error
+}
+
+// A zero Group{} works too, without a context: Wait still returns the first error, but nothing is cancelled.
+
+// WithContext returns a Group and a context that is cancelled as soon as one function returns an error
+func WithContext(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{cancel: cancel}, ctx
+}
+
+func (g *Group) Go(f func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := f(); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				if g.cancel != nil {
+					g.cancel()
+				}
+			})
+		}
+	}()
+}
+
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil { //a zero Group{} has no context to release
+		g.cancel()
 	}
+	return g.err
+}
+
+var errBadName = errors.New("empty name")
+
+// greet is say() that can fail, and that stops early when ctx is cancelled
+func greet(ctx context.Context, s string, times int, out chan<- string) error {
+	if s == "" {
+		return errBadName
+	}
+	for i := 0; i < times; i++ {
+		select {
+		case out <- s:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func errGroupDemo() {
+	fmt.Println("-------ERRGROUP")
 
-	//NOTE: If we comment the line below, nothing prints out. This is because if the main go routine exits, all the go routines that started off within it also exit and hence do not execute. What we want is that the main go routine should wait for all other go routines to finish executing, before it exits itself.
-	time.Sleep(100 * time.Millisecond)
+	//all succeed: every greeting arrives, and Wait returns nil
+	out := make(chan string, 100)
+	g, ctx := WithContext(context.Background())
+	for _, s := range []string{"hello", "world", "gopher"} {
+		g.Go(func() error { return greet(ctx, s, 5, out) })
+	}
+	err := g.Wait()
+	close(out) //safe: Wait returned, so every sender is done
+	count := 0
+	for range out {
+		count++
+	}
+	if err != nil || count != 15 {
+		panic(fmt.Sprintf("errgroup: err=%v, %d greetings", err, count))
+	}
+	fmt.Println("3 goroutines, 15 greetings, error:", err)
+
+	//one fails: Wait returns THAT error, and the others are cancelled instead of blocking forever on a channel nobody reads
+	unread := make(chan string) //nobody receives from this one
+	g, ctx = WithContext(context.Background())
+	g.Go(func() error { return greet(ctx, "hello", 5, unread) })
+	g.Go(func() error { return greet(ctx, "", 5, unread) })
+	err = g.Wait()
+	if !errors.Is(err, errBadName) {
+		panic(fmt.Sprintf("errgroup: got %v", err))
+	}
+	fmt.Println("first error:", err, "- the other goroutine was cancelled")
+
+	//a zero Group, like errgroup's: no context, but it still collects the first error
+	var zero Group
+	zero.Go(func() error { return nil })
+	zero.Go(func() error { return errBadName })
+	err = zero.Wait()
+	if !errors.Is(err, errBadName) {
+		panic(fmt.Sprintf("zero Group: got %v", err))
+	}
+	fmt.Println("zero Group{}: first error:", err)
+}
+
+//-------BOUNDED CONCURRENCY: at most N goroutines working at the same time
+
+/*
+Starting one goroutine per job is fine for 11 jobs, not for a million downloads. A LIMITER lets only N run at once.
+A buffered channel of capacity N is a counting semaphore:
+	-sending takes a slot (blocks while all N are taken)
+	-receiving gives the slot back
+*/
+
+type Limiter struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func NewLimiter(n int) *Limiter {
+	return &Limiter{slots: make(chan struct{}, n)}
+}
+
+// Go waits for a free slot, then runs f in a goroutine
+func (l *Limiter) Go(f func()) {
+	l.slots <- struct{}{}
+	l.wg.Add(1)
+	go func() {
+		defer func() {
+			<-l.slots
+			l.wg.Done()
+		}()
+		f()
+	}()
+}
+
+func (l *Limiter) Wait() {
+	l.wg.Wait()
+}
+
+func limiterDemo() {
+	fmt.Println("-------BOUNDED CONCURRENCY")
+
+	const jobs, limit = 20, 3
+	l := NewLimiter(limit)
+
+	var mu sync.Mutex
+	running, maxRunning, done := 0, 0, 0
+
+	for i := 0; i < jobs; i++ {
+		l.Go(func() {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			//do some work
+			sum := 0
+			for n := 0; n < 100000; n++ {
+				sum += n
+			}
+
+			mu.Lock()
+			running--
+			done++
+			mu.Unlock()
+		})
+	}
+	l.Wait()
+
+	//CHECK: every job ran, and never more than 'limit' at once
+	if done != jobs || maxRunning > limit {
+		panic(fmt.Sprintf("limiter: done=%d maxRunning=%d", done, maxRunning))
+	}
+	fmt.Printf("%d jobs done, at most %d running at the same time (limit %d)\n", done, maxRunning, limit)
 }
@@ -1,11 +1,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync"
 	"time"
 )
 
+/*
+TRACING: go run "6 concurrency_basics.go" "22 runtime_trace.go" --trace out.trace, then go tool trace out.trace
+	-each section of main is a REGION, so the timeline shows which one was running
+	-sliceSum and fibonacci are TASKS: what their goroutines do is grouped under them, with regions inside the functions
+	-every goroutine logs its name, and carries it as a pprof LABEL
+The trace calls cost almost nothing when the lesson is run without --trace.
+*/
+
 func main() {
+	defer trace.Stop() //writes out the end of the trace, if one is being recorded
+	bg := context.Background()
+
 	/*
 		-channel is a technique/construct which allows to let one goroutine to send data (communicate) to another goroutine.
 		-Think of them as pipes through which you can connect with different concurrent goroutines.
@@ -26,28 +42,47 @@ func main() {
 	// IMPORTANT: By default, sends and receives BLOCK until the other side is ready. This allows goroutines to synchronize without explicit locks or condition variables.
 
 	//-----SYNCHRONIZATION OF GO ROUTINES using CHANNELS
+	region := trace.StartRegion(bg, "sliceSum")
+	sumCtx, sumTask := trace.NewTask(bg, "sliceSum of primes")
 	primes := []int{2, 3, 5, 7, 11, 13}
 
-	// Start separate go routines. Sum of Each half calculated separately and communicated back using intChan
-	go sliceSum(primes[:len(primes)/2], intChan, 1) //goroutine 1
-	go sliceSum(primes[len(primes)/2:], intChan, 2) //goroutine 2
+	// Start separate go routines. Sum of Each half calculated separately and communicated back using sumChan
+	//(pprof.Do gives each goroutine a label with its name, for the trace and for CPU profiles)
+	sumChan := make(chan partialSum)
+	go pprof.Do(sumCtx, pprof.Labels("goroutine", "sliceSum 1"), func(ctx context.Context) {
+		sliceSum(ctx, primes[:len(primes)/2], sumChan, 1) //goroutine 1
+	})
+	go pprof.Do(sumCtx, pprof.Labels("goroutine", "sliceSum 2"), func(ctx context.Context) {
+		sliceSum(ctx, primes[len(primes)/2:], sumChan, 2) //goroutine 2
+	})
 
 	// you can send and receive values with the channel operator, <-.
 	// (The data flows in the direction of the arrow.)
 
-	// <-intChan //this is also a valid statement, in case the value from channel is not to be used
+	// <-sumChan //this is also a valid statement, in case the value from channel is not to be used
 
 	fmt.Println("In the main go routine, waiting for partial sum to be received :(")
 	//Until we receive something here, the main go routine stalls at this point. Hence, channels can help block a go routine
 
-	partialSum1, partialSum2 := <-intChan, <-intChan // receive from channel intChan.
+	first, second := <-sumChan, <-sumChan // receive from channel sumChan.
+	//NOTE: both go routines send on the same channel, so 'first' is the sum that ARRIVED first, which is not necessarily the first half.
+	//That is why each goroutine sends its number along with its sum: partialSums[n-1] is the sum of goroutine n, whatever the arrival order.
+	//"16 fan_out_fan_in.go" does the same with sequence numbers, "26 futures.go" gives each goroutine its own Future.
+	var partialSums [2]int
+	partialSums[first.goRoutineNum-1] = first.sum
+	partialSums[second.goRoutineNum-1] = second.sum
 	fmt.Println("In the main go routine, partial sums received FINALLY :D")
 
-	fmt.Println("Partial Sum1:", partialSum1)
-	fmt.Println("Partial Sum2:", partialSum2)
-	fmt.Println("Total:", partialSum1+partialSum2)
+	fmt.Println("Goroutine", first.goRoutineNum, "answered first")
+	fmt.Println("Partial Sum1:", partialSums[0])
+	fmt.Println("Partial Sum2:", partialSums[1])
+	fmt.Println("Total:", partialSums[0]+partialSums[1])
+
+	sumTask.End()
+	region.End()
 
 	// ------CLOSING A CHANNEL
+	region = trace.StartRegion(bg, "closing and range")
 
 	// -A sender can close a channel to indicate that no more values will be sent.
 	// 	-Note: Only the sender should close a channel, never the receiver. Sending on a closed channel will cause a panic.
@@ -83,11 +118,15 @@ func main() {
 	// range/iterate over the queueChan and keep on taking values out of the channel until the channel is closed.
 	// This range iterates over each element as it’s received from queue. Because we closed the channel above, the iteration terminates after receiving the 2 elements.
 	//If the channel has not been closed (by the sender preferably), this loop will create a deadlock situation
+	//"20 checked_channel.go" runs this mistake (and sending on / closing a closed channel) safely and explains it
 	for elem := range queueChan {
 		fmt.Println(elem)
 	}
 
+	region.End()
+
 	//------------------Buffered Channels
+	region = trace.StartRegion(bg, "buffered channels")
 
 	/*
 		- We now know how channels are helpful in transfer of data between go routines.
@@ -103,13 +142,17 @@ func main() {
 		bufferedChan <- s
 	}
 	close(bufferedChan) // dont forget to close channel if a for loop is being used over the 'range' of channel
+	//A buffered channel cannot give up after a timeout or change its capacity. "24 bounded_queue.go" builds a Queue[T] and a Semaphore on top of one that can.
 
 	for val := range bufferedChan {
 		fmt.Print(val, " ")
 	}
 	fmt.Println()
 
+	region.End()
+
 	//-------CAPACITY AND LENGTH OF CHANNELS (just like slices)
+	region = trace.StartRegion(bg, "len and cap")
 
 	/*
 		Length of the Channel: In channel, you can find the length of the channel using len() function. Here, the length indicates the number of value queued in the channel buffer.
@@ -118,7 +161,20 @@ func main() {
 
 	*/
 
+	lenCapChan := make(chan int, 5)
+	lenCapChan <- 10
+	lenCapChan <- 20
+	fmt.Println("len:", len(lenCapChan), "cap:", cap(lenCapChan)) // len: 2 cap: 5
+	<-lenCapChan
+	fmt.Println("len:", len(lenCapChan), "cap:", cap(lenCapChan)) // len: 1 cap: 5 (receiving frees up a slot, cap never changes)
+	fmt.Println("unbuffered intChan cap:", cap(intChan))          // 0: an unbuffered channel has no buffer at all
+
+	//To watch len, cap, closed state and blocked goroutines change step by step, see "19 channel_inspector.go"
+
+	region.End()
+
 	//-------------SELECT STATEMENT
+	region = trace.StartRegion(bg, "select")
 
 	/*
 		- Combining goroutines and channels with select is a powerful feature of Go because select lets us wait on MULTIPLE channel operations.
@@ -134,10 +190,27 @@ func main() {
 	R1 := make(chan string)
 	R2 := make(chan string)
 
+	/*
+		-Only ONE case of the select below runs. The portal that loses would then block FOREVER on its unbuffered send, because nobody will ever receive from its channel. That goroutine is LEAKED: it is never cleaned up while the program runs.
+		-The fix is a context.Context (package context): a value that can be CANCELLED, and that every goroutine can watch through ctx.Done(), a channel that gets closed on cancellation.
+		-context.WithTimeout also cancels it automatically after some time, which gives the select a timeout case.
+	*/
+	goroutinesBefore := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	var portals sync.WaitGroup // counts the portal goroutines still running (WaitGroup: see "5 go_threads.go")
+	portals.Add(2)
+
 	// calling function 1 and
 	// function 2 in goroutine
-	go portal1(R1)
-	go portal2(R2)
+	go func() {
+		defer portals.Done()
+		portal1(ctx, R1)
+	}()
+	go func() {
+		defer portals.Done()
+		portal2(ctx, R2)
+	}()
 
 	select { //select statement BLOCKS until one of the cases is ready (which means until something is received/sent via a channel)
 
@@ -149,13 +222,34 @@ func main() {
 	case op2 := <-R2:
 		fmt.Println(op2)
 
+	// TIMEOUT case: ctx.Done() is closed after 5 seconds if no portal has answered by then. Try changing 5*time.Second to 1*time.Second.
+	case <-ctx.Done():
+		fmt.Println("No portal answered in time:", ctx.Err())
+
 		// //Use a default case to try a send or receive without blocking:
 		// default:
 		// 	fmt.Println("Default select statement run")
 
 	}
 
+	// CANCEL THE LOSER: cancelling closes ctx.Done(), the losing portal's select picks that case and it returns instead of blocking forever.
+	cancel()
+	portals.Wait() // returns once BOTH portal goroutines have called Done
+
+	// CHECK that nothing leaked: a goroutine calls Done a moment BEFORE it has really exited, so give the count a little time to come back down
+	goroutinesAfter := runtime.NumGoroutine()
+	for deadline := time.Now().Add(time.Second); goroutinesAfter > goroutinesBefore && time.Now().Before(deadline); goroutinesAfter = runtime.NumGoroutine() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if goroutinesAfter > goroutinesBefore {
+		panic(fmt.Sprintf("portals leaked: %d goroutines before, %d after", goroutinesBefore, goroutinesAfter))
+	}
+	fmt.Println("Goroutines before the portals:", goroutinesBefore, "after:", goroutinesAfter, "(nothing leaked)")
+
+	region.End()
+
 	//----------SELECT & FOR loop
+	region = trace.StartRegion(bg, "select and for loop")
 
 	//We can iterate over select statement i.e. make the select statement be evaluated more than once using for loops. We can similarly iterate over select statement in an infinite for loop and break out of it given some condition
 
@@ -182,8 +276,13 @@ func main() {
 	}
 
 	fmt.Println("INFINITE for loop with select statements EXITED !")
+	//The default case above makes this loop BUSY WAIT: it keeps waking up even when there is nothing to do. "17 rate_limiter.go" rewrites it without busy waiting.
+
+	region.End()
 
 	//---------GO routines + select + for loop + blocking
+	region = trace.StartRegion(bg, "fibonacci")
+	fibCtx, fibTask := trace.NewTask(bg, "fibonacci")
 
 	fmt.Println("fibonacci TIME")
 	/*
@@ -193,50 +292,90 @@ func main() {
 	numChan := make(chan int)  //channel on which the fibonacci number will be sent for the printFibonacci function to receive it
 	flagChan := make(chan int) //channel on which a 'quit' signal will be sent from printFibonacci function to fibonacci function
 
-	go printFibonacci(numChan, flagChan)
-	fibonacci(numChan, flagChan)
+	go pprof.Do(fibCtx, pprof.Labels("goroutine", "printFibonacci"), func(ctx context.Context) {
+		printFibonacci(ctx, numChan, flagChan)
+	})
+	fibonacci(fibCtx, numChan, flagChan)
+	fibTask.End()
+	region.End()
+
+	//The same thing with a generic generator library: for v := range Take(10, Fibonacci()) { fmt.Println(v) }. See "13 generators.go"
+
+}
 
+// partialSum is what a sliceSum goroutine sends: its sum, and which goroutine it comes from
+type partialSum struct {
+	goRoutineNum int
+	sum          int
 }
 
 //This function takes as input a slice and calculates its sum.
 //Once the sum is calculated, the sum is fed into a channel (which is also provided as argument).
 //The sum value sent into this channel from slideSum go routine, will be received by the channel (same channel in this case) in another go routine (main go routine , in this case)
 //NOTE: We do not return from this function. We use a channel (shared between different go routines) to transfer data / communicate
-func sliceSum(thisSlice []int, myChannel chan int, goRoutineNum int) {
+//ctx carries the trace annotations: a name for this goroutine, and a region for each step
+func sliceSum(ctx context.Context, thisSlice []int, myChannel chan partialSum, goRoutineNum int) {
+	trace.Logf(ctx, "goroutine", "sliceSum %d", goRoutineNum)
 
 	fmt.Println("I Am go routine ", goRoutineNum, "Slice:", thisSlice)
 
 	//calculate partial sum
 	sum := 0
-	for _, val := range thisSlice {
-		sum += val
-	}
+	trace.WithRegion(ctx, "partial sum", func() {
+		for _, val := range thisSlice {
+			sum += val
+		}
+	})
 
 	fmt.Println("I Am go routine ", goRoutineNum, "Sending sum into the channel")
 
 	// you can send and receive values with the channel operator, <-.
 	// (The data flows in the direction of the arrow.)
-	myChannel <- sum
+	//in the trace this region shows how long the goroutine waited for main to receive
+	trace.WithRegion(ctx, "send partial sum", func() {
+		myChannel <- partialSum{goRoutineNum: goRoutineNum, sum: sum} //the number says which half this sum is
+	})
 
 	fmt.Println("I Am go routine ", goRoutineNum, "Exiting go routine now")
 }
 
 // function 1
-func portal1(channel1 chan string) {
+// By convention a context.Context is the FIRST parameter of a function and is named ctx
+func portal1(ctx context.Context, channel1 chan string) {
+
+	// instead of time.Sleep, wait on a timer OR on cancellation, whichever happens first
+	select {
+	case <-time.After(3 * time.Second):
+	case <-ctx.Done():
+		return
+	}
 
-	time.Sleep(3 * time.Second)
-	channel1 <- "Welcome to channel 1"
+	// the send also has to give up on cancellation: this is the send that used to block forever
+	select {
+	case channel1 <- "Welcome to channel 1":
+	case <-ctx.Done():
+	}
 }
 
 // function 2
-func portal2(channel2 chan string) {
+func portal2(ctx context.Context, channel2 chan string) {
 
-	time.Sleep(9 * time.Second)
-	channel2 <- "Welcome to channel 2"
+	select {
+	case <-time.After(9 * time.Second):
+	case <-ctx.Done():
+		return
+	}
+
+	select {
+	case channel2 <- "Welcome to channel 2":
+	case <-ctx.Done():
+	}
 }
 
 //print 10 fibonacci nums as received on a channel
-func printFibonacci(numChan, flagChan chan int) {
+func printFibonacci(ctx context.Context, numChan, flagChan chan int) {
+	trace.Log(ctx, "goroutine", "printFibonacci")
+	defer trace.StartRegion(ctx, "printFibonacci").End() //StartRegion + End is WithRegion for a whole function
 	//loop 10 times and receive a number on channel each time and print it
 	for i := 0; i < 10; i++ {
 		//NOTE: unless numChan receives some data, the channel is blocking i.e. execution halts at the point of the code
@@ -246,7 +385,9 @@ func printFibonacci(numChan, flagChan chan int) {
 	flagChan <- 0
 }
 
-func fibonacci(c, quit chan int) {
+//fibonacci OWNS x and y: no other goroutine can touch them, they only talk to it through c and quit. "25 actors.go" turns this idea into actors.
+func fibonacci(ctx context.Context, c, quit chan int) {
+	defer trace.StartRegion(ctx, "fibonacci generator").End()
 	x, y := 0, 1
 	for {
 		select {
@@ -254,6 +395,7 @@ func fibonacci(c, quit chan int) {
 			//update and find fibonacci num
 			x, y = y, x+y
 		case <-quit: //receiving on a channel
+			trace.Log(ctx, "fibonacci", "quit")
 			fmt.Println("quit")
 			return
 
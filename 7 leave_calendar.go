@@ -0,0 +1,468 @@
+//LEAVE CALENDAR: counting leave in WORKING DAYS instead of bare integers
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+
+In "3 classes_in_golang.go" leave was just an integer: LeavesTaken = LeavesTaken + 3.
+In real life a person asks for leave FROM one date TO another date, and the number of days deducted depends on:
+	-which days of the week are working days (Mon-Fri for most offices, Sun-Thu for some)
+	-which days are public holidays (loaded from a calendar file)
+
+This lesson builds that on top of the same Employee idea. It uses only the standard library, so the calendar file parsers below are deliberately small:
+	-.ics (iCalendar) : only VEVENT blocks with an all-day DTSTART (and optional DTEND) and a SUMMARY are understood
+	-.yaml / .yml     : a list of entries of the form
+		- date: 2025-12-25
+		  name: Christmas
+
+*/
+
+// dateLayout is the layout used everywhere in this lesson to read and print plain dates (no time of day)
+const dateLayout = "2006-01-02"
+
+// WorkingWeek records which weekdays count as working days. Indexed by time.Weekday (Sunday = 0)
+type WorkingWeek [7]bool
+
+// MondayToFriday is the usual office week
+var MondayToFriday = WorkingWeek{time.Monday: true, time.Tuesday: true, time.Wednesday: true, time.Thursday: true, time.Friday: true}
+
+// ParseWorkingWeek reads a comma separated list of short day names e.g. "Mon,Tue,Wed,Thu,Fri" or "Sun,Mon,Tue,Wed,Thu"
+func ParseWorkingWeek(s string) (WorkingWeek, error) {
+	var week WorkingWeek
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.ToLower(d.String()[:3]) == name {
+				week[d] = true
+				found = true
+			}
+		}
+		if !found {
+			return week, fmt.Errorf("unknown weekday %q", name)
+		}
+	}
+	return week, nil
+}
+
+// Holiday is a single day off for everybody
+type Holiday struct {
+	Date time.Time
+	Name string
+}
+
+// HolidayCalendar is a set of holidays, keyed by date so that lookups are fast (remember maps from lesson 1)
+type HolidayCalendar struct {
+	days map[string]Holiday
+}
+
+func NewHolidayCalendar(holidays ...Holiday) *HolidayCalendar {
+	c := &HolidayCalendar{days: make(map[string]Holiday)}
+	for _, h := range holidays {
+		c.Add(h)
+	}
+	return c
+}
+
+func (c *HolidayCalendar) Add(h Holiday) {
+	c.days[h.Date.Format(dateLayout)] = h
+}
+
+// IsHoliday reports whether the date is a holiday and, if it is, which one
+func (c *HolidayCalendar) IsHoliday(d time.Time) (Holiday, bool) {
+	if c == nil { // a nil calendar simply has no holidays
+		return Holiday{}, false
+	}
+	h, ok := c.days[d.Format(dateLayout)]
+	return h, ok
+}
+
+// Holidays returns all holidays sorted by date
+func (c *HolidayCalendar) Holidays() []Holiday {
+	if c == nil {
+		return nil
+	}
+	list := make([]Holiday, 0, len(c.days))
+	for _, h := range c.days {
+		list = append(list, h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Date.Before(list[j].Date) })
+	return list
+}
+
+// LoadHolidayCalendar picks the parser from the file extension (.ics, .yaml or .yml)
+func LoadHolidayCalendar(path string) (*HolidayCalendar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //see "4 deferred_function.go"
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ics":
+		return ParseICS(f)
+	case ".yaml", ".yml":
+		return ParseHolidayYAML(f)
+	}
+	return nil, fmt.Errorf("%s: unsupported calendar format (want .ics, .yaml or .yml)", path)
+}
+
+// ParseICS reads all-day events out of an iCalendar stream. Events spanning several days (DTEND is exclusive in iCalendar) add one holiday per day.
+func ParseICS(r io.Reader) (*HolidayCalendar, error) {
+	cal := NewHolidayCalendar()
+	scanner := bufio.NewScanner(r)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		//iCalendar "folds" long lines: a line starting with a space continues the previous one
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	inEvent := false
+	var start, end time.Time
+	var summary string
+	for n, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		//drop parameters such as DTSTART;VALUE=DATE
+		name, _, _ = strings.Cut(name, ";")
+
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if value == "VEVENT" {
+				inEvent = true
+				start, end, summary = time.Time{}, time.Time{}, ""
+			}
+		case "DTSTART", "DTEND":
+			if !inEvent {
+				continue
+			}
+			if len(value) < 8 {
+				return nil, fmt.Errorf("ics line %d: bad date %q", n+1, value)
+			}
+			d, err := time.Parse("20060102", value[:8]) //only the date part matters for a day off
+			if err != nil {
+				return nil, fmt.Errorf("ics line %d: %v", n+1, err)
+			}
+			if strings.EqualFold(name, "DTSTART") {
+				start = d
+			} else {
+				end = d
+			}
+		case "SUMMARY":
+			if inEvent {
+				summary = value
+			}
+		case "END":
+			if value != "VEVENT" || !inEvent {
+				continue
+			}
+			inEvent = false
+			if start.IsZero() {
+				return nil, fmt.Errorf("ics line %d: event %q has no DTSTART", n+1, summary)
+			}
+			if end.IsZero() || !end.After(start) {
+				end = start.AddDate(0, 0, 1)
+			}
+			for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+				cal.Add(Holiday{Date: d, Name: summary})
+			}
+		}
+	}
+	return cal, nil
+}
+
+// ParseHolidayYAML reads the small YAML subset described at the top of this file
+func ParseHolidayYAML(r io.Reader) (*HolidayCalendar, error) {
+	cal := NewHolidayCalendar()
+	scanner := bufio.NewScanner(r)
+
+	var current *Holiday
+	flush := func(n int) error {
+		if current == nil {
+			return nil
+		}
+		if current.Date.IsZero() {
+			return fmt.Errorf("yaml line %d: holiday %q has no date", n, current.Name)
+		}
+		cal.Add(*current)
+		current = nil
+		return nil
+	}
+
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 { //comments
+			line = line[:i]
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "holidays:" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" { //a new list entry
+			if err := flush(n); err != nil {
+				return nil, err
+			}
+			current = &Holiday{}
+			trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))
+			if trimmed == "" {
+				continue
+			}
+		}
+		if current == nil {
+			return nil, fmt.Errorf("yaml line %d: expected a list entry starting with '-'", n)
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("yaml line %d: expected 'key: value'", n)
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch strings.TrimSpace(key) {
+		case "date":
+			d, err := time.Parse(dateLayout, value)
+			if err != nil {
+				return nil, fmt.Errorf("yaml line %d: %v", n, err)
+			}
+			current.Date = d
+		case "name":
+			current.Name = value
+		default:
+			return nil, fmt.Errorf("yaml line %d: unknown key %q", n, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(n); err != nil {
+		return nil, err
+	}
+	return cal, nil
+}
+
+// LeaveRequest is a range of dates, both ends included
+type LeaveRequest struct {
+	From time.Time
+	To   time.Time
+}
+
+// NewLeaveRequest parses two dates written as YYYY-MM-DD
+func NewLeaveRequest(from, to string) (LeaveRequest, error) {
+	f, err := time.Parse(dateLayout, from)
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	t, err := time.Parse(dateLayout, to)
+	if err != nil {
+		return LeaveRequest{}, err
+	}
+	if t.Before(f) {
+		return LeaveRequest{}, fmt.Errorf("leave ends (%s) before it starts (%s)", to, from)
+	}
+	return LeaveRequest{From: f, To: t}, nil
+}
+
+func (lr LeaveRequest) String() string {
+	return lr.From.Format(dateLayout) + " to " + lr.To.Format(dateLayout)
+}
+
+// LeavePolicy holds the two things needed to turn a date range into a number of days
+type LeavePolicy struct {
+	Week     WorkingWeek
+	Holidays *HolidayCalendar
+}
+
+// Overlaps reports whether the two requests share at least one day
+func (lr LeaveRequest) Overlaps(other LeaveRequest) bool {
+	return !lr.From.After(other.To) && !other.From.After(lr.To)
+}
+
+// WorkingDays counts the days in the request that are working days and not holidays
+func (p LeavePolicy) WorkingDays(lr LeaveRequest) int {
+	days := 0
+	for d := lr.From; !d.After(lr.To); d = d.AddDate(0, 0, 1) {
+		if !p.Week[d.Weekday()] {
+			continue
+		}
+		if _, holiday := p.Holidays.IsHoliday(d); holiday {
+			continue
+		}
+		days++
+	}
+	return days
+}
+
+// ErrNotEnoughLeave is returned when a request would take an employee below zero
+var ErrNotEnoughLeave = errors.New("not enough leave remaining")
+
+// ErrOverlappingLeave is returned when a request shares days with leave that was already approved
+var ErrOverlappingLeave = errors.New("overlaps approved leave")
+
+// Employee is the struct from lesson 3, but leave is now a list of date ranges instead of a counter
+type Employee struct {
+	FirstName   string
+	LastName    string
+	TotalLeaves int
+	Leaves      []LeaveRequest
+	Policy      LeavePolicy
+}
+
+// LeavesTaken is computed from the requests, so it can never disagree with them
+func (e Employee) LeavesTaken() int {
+	taken := 0
+	for _, lr := range e.Leaves {
+		taken += e.Policy.WorkingDays(lr)
+	}
+	return taken
+}
+
+func (e Employee) LeavesRemaining() int {
+	return e.TotalLeaves - e.LeavesTaken()
+}
+
+// RequestLeave is a pointer receiver method (it appends to e.Leaves). It refuses requests that overlap leave already approved
+// (the shared days would be deducted twice), and requests that cost more days than are left.
+func (e *Employee) RequestLeave(lr LeaveRequest) (int, error) {
+	for _, approved := range e.Leaves {
+		if lr.Overlaps(approved) {
+			return 0, fmt.Errorf("%s %s: %s: %w %s", e.FirstName, e.LastName, lr, ErrOverlappingLeave, approved)
+		}
+	}
+	cost := e.Policy.WorkingDays(lr)
+	if cost > e.LeavesRemaining() {
+		return 0, fmt.Errorf("%s %s: %s costs %d days, %d left: %w", e.FirstName, e.LastName, lr, cost, e.LeavesRemaining(), ErrNotEnoughLeave)
+	}
+	e.Leaves = append(e.Leaves, lr)
+	return cost, nil
+}
+
+// sample calendars, written to temporary files in main() so that LoadHolidayCalendar can be shown on real files
+const sampleICS = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20251225
+DTEND;VALUE=DATE:20251226
+SUMMARY:Quaid-e-Azam Day
+END:VEVENT
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20260101
+SUMMARY:New Year's Day
+END:VEVENT
+END:VCALENDAR
+`
+
+const sampleYAML = `holidays:
+  - date: 2025-12-25
+    name: Christmas
+  - date: 2025-12-31
+    name: "New Year's Eve" # half day, counted as a full holiday here
+`
+
+func main() {
+
+	dir, err := os.MkdirTemp("", "leave-calendar")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	icsPath := filepath.Join(dir, "holidays.ics")
+	yamlPath := filepath.Join(dir, "holidays.yaml")
+	if err := os.WriteFile(icsPath, []byte(sampleICS), 0o644); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(yamlPath, []byte(sampleYAML), 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	//-------LOADING HOLIDAY CALENDARS
+	for _, path := range []string{icsPath, yamlPath} {
+		cal, err := LoadHolidayCalendar(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Holidays from", filepath.Base(path))
+		for _, h := range cal.Holidays() {
+			fmt.Printf("  %s %s %s\n", h.Date.Format(dateLayout), h.Date.Weekday().String()[:3], h.Name)
+		}
+	}
+
+	//-------WORKING DAYS vs CALENDAR DAYS
+	cal, err := LoadHolidayCalendar(icsPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	e := Employee{
+		FirstName:   "Sam",
+		LastName:    "Adolf",
+		TotalLeaves: 30,
+		Policy:      LeavePolicy{Week: MondayToFriday, Holidays: cal},
+	}
+
+	//Mon 22 Dec 2025 to Fri 2 Jan 2026 is 12 calendar days but only 8 working days: 2 weekend days and 2 holidays do not count
+	lr, err := NewLeaveRequest("2025-12-22", "2026-01-02")
+	if err != nil {
+		log.Fatal(err)
+	}
+	cost, err := e.RequestLeave(lr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s: %d calendar days, %d working days deducted\n", lr, int(lr.To.Sub(lr.From).Hours()/24)+1, cost)
+	fmt.Printf("%s %s has %d leaves remaining\n", e.FirstName, e.LastName, e.LeavesRemaining())
+
+	//The same request costs something different with a Sunday-Thursday week
+	sunToThu, err := ParseWorkingWeek("Sun,Mon,Tue,Wed,Thu")
+	if err != nil {
+		log.Fatal(err)
+	}
+	other := LeavePolicy{Week: sunToThu, Holidays: cal}
+	fmt.Printf("With a Sun-Thu week the same request costs %d days\n", other.WorkingDays(lr))
+
+	//Asking for more than is left returns an error instead of going negative. errors.Is looks through the %w wrapping.
+	big, _ := NewLeaveRequest("2026-02-02", "2026-03-31")
+	if _, err := e.RequestLeave(big); errors.Is(err, ErrNotEnoughLeave) {
+		fmt.Println("Refused:", err)
+	}
+
+	//A request sharing even one day with approved leave is refused, and nothing is deducted
+	before := e.LeavesRemaining()
+	overlap, _ := NewLeaveRequest("2026-01-02", "2026-01-06")
+	if _, err := e.RequestLeave(overlap); !errors.Is(err, ErrOverlappingLeave) || e.LeavesRemaining() != before {
+		log.Fatalf("overlapping request %s: got error %v and %d days remaining, want ErrOverlappingLeave and %d", overlap, err, e.LeavesRemaining(), before)
+	} else {
+		fmt.Println("Refused:", err)
+	}
+	after, _ := NewLeaveRequest("2026-01-05", "2026-01-06")
+	if _, err := e.RequestLeave(after); err != nil {
+		log.Fatalf("request starting the day after approved leave ends: %v", err)
+	}
+	fmt.Printf("%s right after it is fine: %d leaves remaining\n", after, e.LeavesRemaining())
+}
@@ -0,0 +1,277 @@
+//TEAM LEAVE REPORTS: who is out on which day, and when is a team too empty
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+/*
+
+Lessons 3 and 7 only ever look at ONE Employee. A manager wants the team picture:
+	-an Organization is made of Teams
+	-each Team has a Manager and Members (all of them Employees)
+	-a LeaveReport lists, for every working day in a period, who is out
+	-a day is FLAGGED when more than a configurable share of a team is out at the same time
+
+The same report is rendered three ways using only the standard library:
+	-text table : text/tabwriter lines up columns
+	-CSV        : encoding/csv takes care of quoting
+	-HTML       : html/template escapes names so that a name like "<script>" is harmless
+
+*/
+
+const dateLayout = "2006-01-02"
+
+// LeaveRequest is a range of dates, both ends included (same as lesson 7)
+type LeaveRequest struct {
+	From time.Time
+	To   time.Time
+}
+
+func mustDate(s string) time.Time {
+	d, err := time.Parse(dateLayout, s)
+	if err != nil {
+		panic(err) //only used for the hardcoded sample data below
+	}
+	return d
+}
+
+type Employee struct {
+	FirstName string
+	LastName  string
+	Leaves    []LeaveRequest
+}
+
+func (e Employee) Name() string {
+	return e.FirstName + " " + e.LastName
+}
+
+// IsOut reports whether any of the employee's leave requests covers the day
+func (e Employee) IsOut(day time.Time) bool {
+	for _, lr := range e.Leaves {
+		if !day.Before(lr.From) && !day.After(lr.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// Team members are pointers so that the same Employee can be shared (e.g. a manager who is also counted in the team)
+type Team struct {
+	Name    string
+	Manager *Employee
+	Members []*Employee
+}
+
+// Everyone returns the manager followed by the members, without counting anybody twice
+func (t Team) Everyone() []*Employee {
+	people := make([]*Employee, 0, len(t.Members)+1)
+	seen := make(map[*Employee]bool)
+	for _, e := range append([]*Employee{t.Manager}, t.Members...) {
+		if e == nil || seen[e] {
+			continue
+		}
+		seen[e] = true
+		people = append(people, e)
+	}
+	return people
+}
+
+type Organization struct {
+	Name  string
+	Teams []Team
+}
+
+// ReportOptions control the period covered and when a day is flagged
+type ReportOptions struct {
+	From, To time.Time
+	//MaxOutShare is the share of a team (0 to 1) that may be out at once. A day with MORE than this share out is flagged.
+	MaxOutShare float64
+	//Weekends are skipped unless this is set
+	IncludeWeekends bool
+}
+
+// DayRow is one line of the report: one team on one day
+type DayRow struct {
+	Day     time.Time
+	Team    string
+	Out     []string
+	Size    int
+	Flagged bool
+}
+
+func (r DayRow) Share() float64 {
+	if r.Size == 0 {
+		return 0
+	}
+	return float64(len(r.Out)) / float64(r.Size)
+}
+
+type LeaveReport struct {
+	Organization string
+	Options      ReportOptions
+	Rows         []DayRow
+}
+
+// NewLeaveReport walks every day in the period for every team. Days on which nobody is out are left out of the report.
+func NewLeaveReport(org Organization, opts ReportOptions) (*LeaveReport, error) {
+	if opts.To.Before(opts.From) {
+		return nil, fmt.Errorf("report ends (%s) before it starts (%s)", opts.To.Format(dateLayout), opts.From.Format(dateLayout))
+	}
+	if opts.MaxOutShare < 0 || opts.MaxOutShare > 1 {
+		return nil, fmt.Errorf("MaxOutShare must be between 0 and 1, got %v", opts.MaxOutShare)
+	}
+
+	report := &LeaveReport{Organization: org.Name, Options: opts}
+	for day := opts.From; !day.After(opts.To); day = day.AddDate(0, 0, 1) {
+		if !opts.IncludeWeekends && (day.Weekday() == time.Saturday || day.Weekday() == time.Sunday) {
+			continue
+		}
+		for _, team := range org.Teams {
+			people := team.Everyone()
+			row := DayRow{Day: day, Team: team.Name, Size: len(people)}
+			for _, e := range people {
+				if e.IsOut(day) {
+					row.Out = append(row.Out, e.Name())
+				}
+			}
+			if len(row.Out) == 0 {
+				continue
+			}
+			sort.Strings(row.Out)
+			row.Flagged = row.Share() > opts.MaxOutShare
+			report.Rows = append(report.Rows, row)
+		}
+	}
+	return report, nil
+}
+
+// Flagged returns only the rows where too much of a team is out
+func (r *LeaveReport) Flagged() []DayRow {
+	var flagged []DayRow
+	for _, row := range r.Rows {
+		if row.Flagged {
+			flagged = append(flagged, row)
+		}
+	}
+	return flagged
+}
+
+//-------RENDERERS. All of them write to an io.Writer so the same code can print to the console, a file or an HTTP response.
+
+func (r *LeaveReport) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tDAY\tTEAM\tOUT\tSHARE\tFLAG")
+	for _, row := range r.Rows {
+		flag := ""
+		if row.Flagged {
+			flag = "!!"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d/%d\t%s\n", row.Day.Format(dateLayout), row.Day.Weekday().String()[:3], row.Team, strings.Join(row.Out, ", "), len(row.Out), row.Size, flag)
+	}
+	return tw.Flush()
+}
+
+func (r *LeaveReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"date", "team", "out", "out_count", "team_size", "flagged"}); err != nil {
+		return err
+	}
+	for _, row := range r.Rows {
+		record := []string{
+			row.Day.Format(dateLayout),
+			row.Team,
+			strings.Join(row.Out, "; "),
+			fmt.Sprint(len(row.Out)),
+			fmt.Sprint(row.Size),
+			fmt.Sprint(row.Flagged),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.Format(dateLayout) },
+	"join": strings.Join,
+	"pct":  func(f float64) string { return fmt.Sprintf("%.0f%%", f*100) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Organization}} leave report</title>
+<style>td,th{padding:4px 8px;border:1px solid #ccc} tr.flagged{background:#fdd}</style>
+</head>
+<body>
+<h1>{{.Organization}}: {{date .Options.From}} to {{date .Options.To}}</h1>
+<table>
+<tr><th>Date</th><th>Team</th><th>Out</th><th>Share</th></tr>
+{{- range .Rows}}
+<tr{{if .Flagged}} class="flagged"{{end}}><td>{{date .Day}}</td><td>{{.Team}}</td><td>{{join .Out ", "}}</td><td>{{pct .Share}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+func (r *LeaveReport) WriteHTML(w io.Writer) error {
+	return reportHTML.Execute(w, r)
+}
+
+func main() {
+
+	ali := &Employee{FirstName: "Ali", LastName: "Khan", Leaves: []LeaveRequest{{mustDate("2025-12-22"), mustDate("2025-12-24")}}}
+	sara := &Employee{FirstName: "Sara", LastName: "Ahmed", Leaves: []LeaveRequest{{mustDate("2025-12-23"), mustDate("2025-12-26")}}}
+	sam := &Employee{FirstName: "Sam", LastName: "Adolf", Leaves: []LeaveRequest{{mustDate("2025-12-24"), mustDate("2025-12-24")}}}
+	zoe := &Employee{FirstName: "Zoe", LastName: "Lee"}
+	omar := &Employee{FirstName: "Omar", LastName: "Farooq", Leaves: []LeaveRequest{{mustDate("2025-12-26"), mustDate("2026-01-02")}}}
+	nida := &Employee{FirstName: "Nida", LastName: "Aslam"}
+
+	org := Organization{
+		Name: "LUMS IT",
+		Teams: []Team{
+			{Name: "Platform", Manager: zoe, Members: []*Employee{ali, sara, sam}},
+			{Name: "Support", Manager: nida, Members: []*Employee{omar}},
+		},
+	}
+
+	report, err := NewLeaveReport(org, ReportOptions{
+		From:        mustDate("2025-12-22"),
+		To:          mustDate("2025-12-31"),
+		MaxOutShare: 0.5, //flag a day when more than half of a team is out
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("-------TEXT TABLE")
+	if err := report.WriteText(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("-------FLAGGED DAYS")
+	for _, row := range report.Flagged() {
+		fmt.Printf("%s %s: %d of %d out (%s)\n", row.Day.Format(dateLayout), row.Team, len(row.Out), row.Size, strings.Join(row.Out, ", "))
+	}
+
+	fmt.Println("-------CSV")
+	if err := report.WriteCSV(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("-------HTML")
+	if err := report.WriteHTML(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,384 @@
+//VALUE vs POINTER RECEIVERS: a tool that inspects method sets using go/types
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+
+"3 classes_in_golang.go" says: try removing the * from UpdateLeavesTaken and observe.
+What you observe is... nothing. The program still compiles and runs, the leave count just silently stops changing, because a value receiver works on a COPY.
+
+This tool lets the compiler's own type checker explain what is going on. For every named type in the given Go files it prints:
+	-the method set of T and of *T
+	-value receiver methods that assign to fields (or array elements) of the receiver (the silent no-op bug above)
+	-which interfaces (declared in the files, plus error and fmt.Stringer) T and *T satisfy
+
+Usage:
+	go run "9 receiver_inspector.go" [file.go ...]
+
+With no arguments it inspects "3 classes_in_golang.go" twice: once as written, and once with the * removed from UpdateLeavesTaken, exactly as the lesson suggests.
+
+The standard library packages used:
+	-go/parser : source text -> syntax tree (AST)
+	-go/types  : AST -> types, method sets and interface checks (the same logic the compiler uses)
+	-go/ast    : walking the syntax tree to find assignments
+
+*/
+
+// Report is everything the tool found for one named type
+type Report struct {
+	Name             string
+	ValueMethods     []string //method set of T
+	PointerMethods   []string //method set of *T
+	MutatingValue    []string //value receiver methods that write to the receiver
+	ValueSatisfies   []string
+	PointerSatisfies []string
+}
+
+// Inspect parses and type checks one package made of the given sources (file name -> content, content may be nil to read from disk)
+func Inspect(filenames []string, sources map[string][]byte) ([]Report, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range filenames {
+		var src any
+		if s, ok := sources[name]; ok {
+			src = s
+		}
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	pkg, err := conf.Check(files[0].Name.Name, fset, files, info)
+	if err != nil {
+		return nil, err
+	}
+
+	ifaces := interfacesIn(pkg)
+	mutating := findMutatingValueReceivers(files, info)
+
+	var reports []Report
+	scope := pkg.Scope()
+	for _, name := range scope.Names() { //Names() is already sorted
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || tn.IsAlias() {
+			continue
+		}
+		named, ok := tn.Type().(*types.Named)
+		if !ok {
+			continue
+		}
+		if _, isIface := named.Underlying().(*types.Interface); isIface {
+			continue //interfaces have no receivers of their own
+		}
+
+		ptr := types.NewPointer(named)
+		r := Report{
+			Name:           name,
+			ValueMethods:   methodNames(named),
+			PointerMethods: methodNames(ptr),
+			MutatingValue:  mutating[name],
+		}
+		for _, iface := range ifaces {
+			if types.Implements(named, iface.typ) {
+				r.ValueSatisfies = append(r.ValueSatisfies, iface.name)
+			}
+			if types.Implements(ptr, iface.typ) {
+				r.PointerSatisfies = append(r.PointerSatisfies, iface.name)
+			}
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+// methodNames lists the method set of t. Promoted methods (from embedded fields) are included, just like the compiler sees them.
+func methodNames(t types.Type) []string {
+	mset := types.NewMethodSet(t)
+	names := make([]string, 0, mset.Len())
+	for i := 0; i < mset.Len(); i++ {
+		sel := mset.At(i)
+		name := sel.Obj().Name()
+		if len(sel.Index()) > 1 {
+			name += " (promoted)"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+type namedInterface struct {
+	name string
+	typ  *types.Interface
+}
+
+// interfacesIn returns the interfaces declared in the package plus two everybody knows: error and fmt.Stringer
+func interfacesIn(pkg *types.Package) []namedInterface {
+	var list []namedInterface
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		if iface, ok := tn.Type().Underlying().(*types.Interface); ok && iface.NumMethods() > 0 {
+			list = append(list, namedInterface{name, iface})
+		}
+	}
+
+	errIface := types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+	stringer := types.NewInterfaceType([]*types.Func{
+		types.NewFunc(token.NoPos, nil, "String", types.NewSignatureType(nil, nil, nil, nil,
+			types.NewTuple(types.NewVar(token.NoPos, nil, "", types.Typ[types.String])), false)),
+	}, nil).Complete()
+	return append(list, namedInterface{"error", errIface}, namedInterface{"fmt.Stringer", stringer})
+}
+
+// findMutatingValueReceivers looks inside every method with a VALUE receiver for statements like
+//
+//	e.Field = x    e.Field += x    e.Field++    e.Inner.Field = x    e.Array[i] = x
+//
+// Those writes go to the copy and are thrown away when the method returns. An ARRAY is a value like a struct, so it is copied
+// with the receiver. Writes through a slice or map index (e.Slice[i] = x) or a pointer field are NOT reported: the copy shares
+// the slice's backing array, the map and the pointed-to data with the caller, so those writes do reach the caller.
+func findMutatingValueReceivers(files []*ast.File, info *types.Info) map[string][]string {
+	found := make(map[string][]string)
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || len(fn.Recv.List) == 0 || fn.Body == nil {
+				continue
+			}
+			recv := fn.Recv.List[0]
+			if _, isPtr := recv.Type.(*ast.StarExpr); isPtr || len(recv.Names) == 0 {
+				continue
+			}
+			recvObj := info.Defs[recv.Names[0]]
+			if recvObj == nil {
+				continue
+			}
+			typeName := types.TypeString(recvObj.Type(), func(*types.Package) string { return "" })
+
+			var writes []string
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				var targets []ast.Expr
+				switch s := n.(type) {
+				case *ast.AssignStmt:
+					if s.Tok != token.DEFINE {
+						targets = s.Lhs
+					}
+				case *ast.IncDecStmt:
+					targets = []ast.Expr{s.X}
+				}
+				for _, lhs := range targets {
+					if field, ok := fieldOfReceiver(lhs, recvObj, info); ok {
+						writes = append(writes, field)
+					}
+				}
+				return true
+			})
+			if len(writes) > 0 {
+				found[typeName] = append(found[typeName], fmt.Sprintf("%s writes %s", fn.Name.Name, strings.Join(writes, ", ")))
+			}
+		}
+	}
+	return found
+}
+
+// fieldOfReceiver reports whether expr is a chain of field selections and array indexes starting at the receiver, e.g. e.Person.FirstName or e.Days[i]
+func fieldOfReceiver(expr ast.Expr, recv types.Object, info *types.Info) (string, bool) {
+	path := ""
+	for {
+		switch x := expr.(type) {
+		case *ast.SelectorExpr:
+			//stop at pointer fields: writing through a pointer is visible to the caller
+			if t := info.TypeOf(x.X); t == nil {
+				return "", false
+			} else if _, isPtr := t.Underlying().(*types.Pointer); isPtr {
+				return "", false
+			}
+			path = "." + x.Sel.Name + path
+			expr = x.X
+		case *ast.IndexExpr:
+			//only an array is part of the copy: a slice or a map index writes to data the caller shares
+			if t := info.TypeOf(x.X); t == nil {
+				return "", false
+			} else if _, isArray := t.Underlying().(*types.Array); !isArray {
+				return "", false
+			}
+			path = "[" + types.ExprString(x.Index) + "]" + path
+			expr = x.X
+		case *ast.ParenExpr:
+			expr = x.X
+		case *ast.Ident:
+			if path == "" || info.Uses[x] != recv {
+				return "", false
+			}
+			return x.Name + path, true
+		default:
+			return "", false //calls, derefs...
+		}
+	}
+}
+
+func printReports(title string, reports []Report) {
+	fmt.Println("=====", title)
+	list := func(items []string) string {
+		if len(items) == 0 {
+			return "(none)"
+		}
+		sort.Strings(items)
+		return strings.Join(items, ", ")
+	}
+	for _, r := range reports {
+		fmt.Printf("type %s\n", r.Name)
+		fmt.Printf("  method set of %-12s %s\n", r.Name+":", list(r.ValueMethods))
+		fmt.Printf("  method set of %-12s %s\n", "*"+r.Name+":", list(r.PointerMethods))
+		fmt.Printf("  %-11s satisfies:  %s\n", r.Name, list(r.ValueSatisfies))
+		fmt.Printf("  %-11s satisfies:  %s\n", "*"+r.Name, list(r.PointerSatisfies))
+		for _, m := range r.MutatingValue {
+			fmt.Printf("  WARNING: value receiver %s: the change is made to a copy and lost when the method returns\n", m)
+		}
+	}
+}
+
+const lesson3 = "3 classes_in_golang.go"
+
+// indexWrites has one value receiver method per kind of indexed write. Only the array ones are made to the copy.
+const indexWrites = `package p
+
+type Week [7]bool
+
+type Schedule struct {
+	Days    [7]bool
+	Weeks   [][7]bool
+	Shifts  []string
+	Notes   map[string]string
+	Default *[7]bool
+}
+
+func (s Schedule) SetDay(i int)     { s.Days[i] = true }
+func (s Schedule) SetWeekDay(i int) { s.Weeks[0][i] = true }
+func (s Schedule) SetShift(i int)   { s.Shifts[i] = "night" }
+func (s Schedule) SetNote(k string) { s.Notes[k] = "ok" }
+func (s Schedule) SetDefault(i int) { s.Default[i] = true }
+func (w Week) Set(i int)            { w[i] = true }
+`
+
+// expectIndexWrites checks that array index writes are reported like field writes, and slice, map and pointer index writes are not
+func expectIndexWrites() {
+	const name = "index_writes.go"
+	reports, err := Inspect([]string{name}, map[string][]byte{name: []byte(indexWrites)})
+	if err != nil {
+		log.Fatal(err)
+	}
+	printReports(name, reports)
+	want := map[string]string{
+		"Schedule": "SetDay writes s.Days[i]",
+		"Week":     "Set writes w[i]",
+	}
+	for _, r := range reports {
+		if got := strings.Join(r.MutatingValue, "; "); got != want[r.Name] {
+			log.Fatalf("%s: lost writes of %s are %q, want %q", name, r.Name, got, want[r.Name])
+		}
+	}
+	fmt.Println("ok:", name, "- array index writes are reported, slice, map and pointer index writes are not")
+}
+
+// expectEmployee checks the report for Employee. The inspector is only useful if it keeps seeing what the lesson teaches, so a difference stops the program.
+func expectEmployee(label string, reports []Report, valueMethods, pointerMethods []string, warning bool) {
+	for _, r := range reports {
+		if r.Name != "Employee" {
+			continue
+		}
+		if got, want := strings.Join(r.ValueMethods, ", "), strings.Join(valueMethods, ", "); got != want {
+			log.Fatalf("%s: method set of Employee is %q, want %q", label, got, want)
+		}
+		if got, want := strings.Join(r.PointerMethods, ", "), strings.Join(pointerMethods, ", "); got != want {
+			log.Fatalf("%s: method set of *Employee is %q, want %q", label, got, want)
+		}
+		flagged := false
+		for _, m := range r.MutatingValue {
+			flagged = flagged || strings.HasPrefix(m, "UpdateLeavesTaken ")
+		}
+		if flagged != warning {
+			log.Fatalf("%s: UpdateLeavesTaken flagged as a lost write: %v, want %v (%v)", label, flagged, warning, r.MutatingValue)
+		}
+		if len(r.PointerSatisfies) != 1 || r.PointerSatisfies[0] != "LeaveHolder" || len(r.ValueSatisfies) != 0 {
+			log.Fatalf("%s: Employee satisfies %v, *Employee satisfies %v, want nothing and LeaveHolder", label, r.ValueSatisfies, r.PointerSatisfies)
+		}
+		fmt.Println("ok:", label, "- method sets and warnings of Employee are as expected")
+		return
+	}
+	log.Fatalf("%s: no report for Employee", label)
+}
+
+func main() {
+
+	if len(os.Args) > 1 {
+		reports, err := Inspect(os.Args[1:], nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printReports(strings.Join(os.Args[1:], " "), reports)
+		return
+	}
+
+	//-------FIRST TEST CASE: the lesson as written
+	src, err := os.ReadFile(lesson3)
+	if err != nil {
+		log.Fatalf("run this from the tutorial directory: %v", err)
+	}
+	reports, err := Inspect([]string{lesson3}, map[string][]byte{lesson3: src})
+	if err != nil {
+		log.Fatal(err)
+	}
+	printReports(lesson3, reports)
+	expectEmployee(lesson3, reports,
+		[]string{"FullName (promoted)", "LeaveBalance", "LeavesRemaining"},
+		[]string{"FullName (promoted)", "LeaveBalance", "LeavesRemaining", "TakeLeave", "UpdateLeavesTaken"},
+		false)
+
+	//-------SECOND TEST CASE: "Try removing the * from the declaration of the UpdateLeavesTaken function"
+	const withPointer = "func (e *Employee) UpdateLeavesTaken()"
+	if !strings.Contains(string(src), withPointer) {
+		log.Fatalf("%s no longer declares %q", lesson3, withPointer)
+	}
+	modified := strings.Replace(string(src), withPointer, "func (e Employee) UpdateLeavesTaken()", 1)
+	reports, err = Inspect([]string{lesson3}, map[string][]byte{lesson3: []byte(modified)})
+	if err != nil {
+		//removing the * can also break compilation elsewhere, which is a lesson of its own
+		fmt.Println("=====", lesson3, "without the *")
+		fmt.Println("does not type check any more:", err)
+		return
+	}
+	printReports(lesson3+" without the *", reports)
+	//UpdateLeavesTaken moves into the method set of the VALUE, and its write to e.LeavesTaken is now lost
+	expectEmployee(lesson3+" without the *", reports,
+		[]string{"FullName (promoted)", "LeaveBalance", "LeavesRemaining", "UpdateLeavesTaken"},
+		[]string{"FullName (promoted)", "LeaveBalance", "LeavesRemaining", "TakeLeave", "UpdateLeavesTaken"},
+		true)
+
+	//-------THIRD TEST CASE: writes through an index
+	expectIndexWrites()
+}